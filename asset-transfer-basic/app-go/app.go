@@ -2,8 +2,6 @@ package main
 
 import (
 	"bytes"
-	"crypto/aes"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -13,10 +11,12 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
 	"github.com/hyperledger/fabric-sdk-go/pkg/core/config"
 	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
 	"github.com/joho/godotenv"
@@ -28,9 +28,113 @@ type Device struct {
 	Status string `json:"status"`
 	Key    string `json:"key"`
 }
+type Device_credential struct {
+	ID                    string `json:"ID"`
+	Status                string `json:"Status"`
+	Key                   string `json:"Key"`
+	KeyType               string `json:"KeyType"`
+	KeyVersion            int    `json:"KeyVersion"`
+	PublicKey             string `json:"PublicKey"`
+	PreviousKey           string `json:"PreviousKey"`
+	PreviousKeyValidUntil string `json:"PreviousKeyValidUntil"`
+}
 type Device_list struct {
-	ID     string `json:"id"`
-	Status string `json:"status"`
+	ID               string   `json:"id"`
+	Status           string   `json:"status"`
+	Model            string   `json:"model,omitempty"`
+	Firmware         string   `json:"firmware,omitempty"`
+	Owner            string   `json:"owner,omitempty"`
+	OwnerMSP         string   `json:"ownerMSP,omitempty"`
+	Site             string   `json:"site,omitempty"`
+	MAC              string   `json:"mac,omitempty"`
+	Tags             []string `json:"tags,omitempty"`
+	SchemaVersion    int      `json:"schemaVersion,omitempty"`
+	ValidFrom        string   `json:"validFrom,omitempty"`
+	ValidUntil       string   `json:"validUntil,omitempty"`
+	SuspendedUntil   string   `json:"suspendedUntil,omitempty"`
+	SuspensionReason string   `json:"suspensionReason,omitempty"`
+}
+
+// Device_metadata holds the optional descriptive fields of a device. Fields
+// left out of an update request keep their value on the ledger.
+type Device_metadata struct {
+	Model    *string   `json:"model,omitempty"`
+	Firmware *string   `json:"firmware,omitempty"`
+	Owner    *string   `json:"owner,omitempty"`
+	Site     *string   `json:"site,omitempty"`
+	MAC      *string   `json:"mac,omitempty"`
+	Tags     *[]string `json:"tags,omitempty"`
+}
+type Device_page struct {
+	Devices             []Device_list `json:"devices"`
+	FetchedRecordsCount int32         `json:"fetchedRecordsCount"`
+	Bookmark            string        `json:"bookmark"`
+}
+type Status_info struct {
+	Status      string   `json:"status"`
+	Transitions []string `json:"transitions"`
+}
+type History_entry struct {
+	TxID             string `json:"txId"`
+	Timestamp        string `json:"timestamp"`
+	IsDelete         bool   `json:"isDelete"`
+	DeletedAt        string `json:"deletedAt,omitempty"`
+	Status           string `json:"status,omitempty"`
+	UpdatedBy        string `json:"updatedBy,omitempty"`
+	ValidFrom        string `json:"validFrom,omitempty"`
+	ValidUntil       string `json:"validUntil,omitempty"`
+	SuspendedUntil   string `json:"suspendedUntil,omitempty"`
+	SuspensionReason string `json:"suspensionReason,omitempty"`
+}
+type Revoked_device struct {
+	ID         string `json:"id"`
+	Reason     string `json:"reason"`
+	KeyVersion int    `json:"keyVersion,omitempty"`
+	Reserved   bool   `json:"reserved,omitempty"`
+	Since      string `json:"since,omitempty"`
+}
+type Revocation_list struct {
+	GeneratedAt string           `json:"generatedAt"`
+	Devices     []Revoked_device `json:"devices"`
+}
+type Device_event struct {
+	Event            string   `json:"Event"`
+	DeviceID         string   `json:"DeviceID"`
+	DeviceIDs        []string `json:"DeviceIDs"`
+	Group            string   `json:"Group"`
+	OldStatus        string   `json:"OldStatus"`
+	NewStatus        string   `json:"NewStatus"`
+	FromMSP          string   `json:"FromMSP"`
+	ToMSP            string   `json:"ToMSP"`
+	MerkleRoot       string   `json:"MerkleRoot"`
+	ProposalID       string   `json:"ProposalID"`
+	SuspendedUntil   string   `json:"SuspendedUntil"`
+	SuspensionReason string   `json:"SuspensionReason"`
+	Timestamp        string   `json:"Timestamp"`
+}
+type Device_endorsement struct {
+	DeviceID string   `json:"deviceId"`
+	MSPIDs   []string `json:"mspIds"`
+}
+type Device_transfer struct {
+	DeviceID    string `json:"deviceId"`
+	FromMSP     string `json:"fromMSP"`
+	ToMSP       string `json:"toMSP"`
+	RequestedBy string `json:"requestedBy"`
+	RequestedAt string `json:"requestedAt"`
+}
+type Auth_attempt struct {
+	DeviceID  string `json:"deviceId"`
+	Gateway   string `json:"gateway"`
+	Outcome   string `json:"outcome"`
+	Reason    string `json:"reason,omitempty"`
+	Timestamp string `json:"timestamp"`
+	TxID      string `json:"txId"`
+}
+type Lockout struct {
+	DeviceID    string `json:"deviceId"`
+	Failures    int    `json:"failures"`
+	LockedUntil string `json:"lockedUntil,omitempty"`
 }
 type User struct {
 	Name     string `json:"username"`
@@ -45,6 +149,9 @@ type Res_body struct {
 var result []byte
 var err error
 
+// defaultPageSize is used by paginated queries that do not ask for a page size
+const defaultPageSize = 50
+
 func usr_name() string {
 	var letters = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
 
@@ -89,17 +196,6 @@ func main() {
 	walletPath := "wallet"
 	// remove any existing wallet from prior runs
 	os.RemoveAll(walletPath)
-	wallet, err := gateway.NewFileSystemWallet(walletPath)
-	if err != nil {
-		log.Fatalf("Failed to create wallet: %v", err)
-	}
-
-	if !wallet.Exists("appUser") {
-		err = populateWallet(wallet)
-		if err != nil {
-			log.Fatalf("Failed to populate wallet contents: %v", err)
-		}
-	}
 
 	ccpPath := filepath.Join(
 		"..",
@@ -111,58 +207,225 @@ func main() {
 		"connection-org1.yaml",
 	)
 
-	gw, err := gateway.Connect(
-		gateway.WithConfig(config.FromFile(filepath.Clean(ccpPath))),
-		gateway.WithIdentity(wallet, "appUser"),
-	)
-	if err != nil {
-		log.Fatalf("Failed to connect to gateway: %v", err)
-	}
-	defer gw.Close()
-
 	channelName := "mychannel"
 	if cname := os.Getenv("CHANNEL_NAME"); cname != "" {
 		channelName = cname
 	}
 
-	log.Println("--> Connecting to channel", channelName)
-	network, err := gw.GetNetwork(channelName)
-	if err != nil {
-		log.Fatalf("Failed to get network: %v", err)
-	}
-
 	chaincodeName := "basic"
 	if ccname := os.Getenv("CHAINCODE_NAME"); ccname != "" {
 		chaincodeName = ccname
 	}
 
-	log.Println("--> Using chaincode", chaincodeName)
-	contract := network.GetContract(chaincodeName)
+	// the admins are enrolled with their role attributes by
+	// enrollIdentities.sh, which also issues each of them a login token.
+	// Requests act as the admin whose token they carry, so that each admin
+	// approves changes as themselves; the first admin also runs the
+	// application's own transactions.
+	loginPath := "logins"
+	if path := os.Getenv("APP_LOGINS"); path != "" {
+		loginPath = path
+	}
+	ids, err := loadLogins(loginPath)
+	if err != nil {
+		log.Fatalf("Failed to load admin logins: %v (run ./enrollIdentities.sh to enroll an admin)", err)
+	}
+	var qscc *gateway.Contract
+	for i, label := range ids.labels {
+		gw, network := connect(walletPath, label, ccpPath, channelName)
+		defer gw.Close()
+		ids.add(label, network.GetContract(chaincodeName))
+		if i == 0 {
+			// anchoring transactions are read from the ledger through qscc
+			qscc = network.GetContract("qscc")
+		}
+	}
+	contract := ids.contracts[ids.labels[0]]
+
+	// devices are authenticated by a separate identity holding the gateway
+	// role, which alone may read device keys
+	gatewayIdentity := "gateway1"
+	if label := os.Getenv("APP_GATEWAY_IDENTITY"); label != "" {
+		gatewayIdentity = label
+	}
+	authGw, authNetwork := connect(walletPath, gatewayIdentity, ccpPath, channelName)
+	defer authGw.Close()
+	authContract := authNetwork.GetContract(chaincodeName)
+
+	// device keys are only stored on the peers of the owning organization
+	authPeer := "peer0.org1.example.com"
+	if peer := os.Getenv("AUTH_PEER"); peer != "" {
+		authPeer = peer
+	}
+
+	// shared by every instance of the app serving /auth
+	noncePath := "nonces"
+	if path := os.Getenv("NONCE_STORE"); path != "" {
+		noncePath = path
+	}
+	nonceTTL := time.Minute
+	if ttl := os.Getenv("NONCE_TTL"); ttl != "" {
+		if nonceTTL, err = time.ParseDuration(ttl); err != nil {
+			log.Fatalf("Invalid NONCE_TTL: %v", err)
+		}
+	}
+	nonces, err := newNonceStore(noncePath, nonceTTL)
+	if err != nil {
+		log.Fatalf("Failed to load nonce store: %v", err)
+	}
+
+	attemptPath := "auth-attempts.json"
+	if path := os.Getenv("ATTEMPT_QUEUE"); path != "" {
+		attemptPath = path
+	}
+	// matches the default lockout threshold of the contract
+	pendingFailures := 5
+	if limit := os.Getenv("PENDING_FAILURE_LIMIT"); limit != "" {
+		if pendingFailures, err = strconv.Atoi(limit); err != nil || pendingFailures < 1 {
+			log.Fatalf("Invalid PENDING_FAILURE_LIMIT %q, expected a positive number", limit)
+		}
+	}
+	attempts, err := newAttemptQueue(attemptPath, authContract, pendingFailures)
+	if err != nil {
+		log.Fatalf("Failed to load attempt queue: %v", err)
+	}
 
 	result, err := contract.SubmitTransaction("InitLedger")
 	if err != nil {
 		log.Fatalf("Failed to Submit transaction: %v", err)
 	}
 	log.Println(string(result))
-	contract.SubmitTransaction("Delete", "D0")
+
+	// every event of the contract, including snapshot anchors and
+	// configuration changes
+	reg, notifier, err := contract.RegisterEvent(".*")
+	if err != nil {
+		log.Fatalf("Failed to register for chaincode events: %v", err)
+	}
+	defer contract.Unregister(reg)
+	go listenForEvents(notifier)
 
 	// Define routes
-	router.POST("/register", register(contract))
+	router.POST("/register", ids.handle(register))
+
+	router.POST("/update", ids.handle(update))
+
+	router.POST("/auth/challenge", challenge(authContract, authPeer, nonces))
+
+	router.POST("/auth", auth(authContract, authPeer, nonces, attempts))
+
+	router.POST("/delete", ids.handle(deleteDevice))
+
+	router.GET("/getall", ids.handle(GetAll))
+
+	router.GET("/statuses", ids.handle(statuses))
+
+	router.GET("/devices/:id/history", ids.handle(history))
+
+	router.GET("/revocations", ids.handle(revocations))
+
+	router.GET("/revocations/snapshot", ids.handle(func(contract *gateway.Contract) gin.HandlerFunc {
+		return revocationSnapshot(contract, qscc, channelName)
+	}))
+
+	router.POST("/revocations/snapshot", ids.handle(anchorSnapshot))
+
+	router.POST("/devices/query", ids.handle(query))
+
+	router.POST("/devices/:id/rotate-key", ids.handle(rotateKey))
+
+	router.GET("/devices/:id/auth-attempts", ids.handle(authAttempts))
+
+	router.GET("/devices/:id/lockout", ids.handle(lockout))
+
+	router.POST("/devices/:id/clear-lockout", ids.handle(clearLockout))
+
+	router.POST("/devices/import", ids.handle(importDevices))
+
+	router.POST("/devices/:id/transfer", ids.handle(transfer))
+
+	router.GET("/devices/:id/transfer", ids.handle(pendingTransfer))
+
+	router.POST("/devices/:id/transfer/accept", ids.handle(acceptTransfer))
+
+	router.POST("/devices/:id/transfer/cancel", ids.handle(cancelTransfer))
+
+	router.GET("/devices/:id/endorsement", ids.handle(endorsement))
+
+	router.POST("/devices/:id/endorsement", ids.handle(setEndorsement))
+
+	router.POST("/devices/:id/validity", ids.handle(setValidity))
+
+	router.GET("/devices/expiring", ids.handle(expiringDevices))
+
+	router.POST("/devices/:id/reactivate", ids.handle(reactivate))
+
+	router.POST("/devices/:id/suspend", ids.handle(suspend))
 
-	router.POST("/update", update(contract))
+	router.GET("/proposals", ids.handle(proposals))
 
-	router.POST("/auth", auth(contract))
+	router.GET("/proposals/:id", ids.handle(proposal))
 
-	router.POST("/delete", delete(contract))
+	router.POST("/proposals/:id/approve", ids.handle(approveProposal))
 
-	router.GET("/getall", GetAll(contract))
+	router.POST("/groups", ids.handle(createGroup))
+
+	router.GET("/groups", ids.handle(groups))
+
+	router.GET("/groups/:name/members", ids.handle(groupMembers))
+
+	router.POST("/groups/:name/members", ids.handle(func(contract *gateway.Contract) gin.HandlerFunc {
+		return changeMembers(contract, "AddGroupMembers", "Devices added to group")
+	}))
+
+	router.POST("/groups/:name/members/remove", ids.handle(func(contract *gateway.Contract) gin.HandlerFunc {
+		return changeMembers(contract, "RemoveGroupMembers", "Devices removed from group")
+	}))
+
+	router.POST("/groups/:name/status", ids.handle(groupStatus))
+
+	router.POST("/groups/:name/delete", ids.handle(deleteGroup))
 
 	// Run the server
 	if err := router.Run(":3001"); err != nil {
 		log.Fatalf("Failed to run server: %v", err)
 	}
 }
-func populateWallet(wallet *gateway.Wallet) error {
+
+// connect opens a gateway connection as the identity label, which is kept
+// in a wallet of its own under walletPath, and returns the network of
+// channelName
+func connect(walletPath string, label string, ccpPath string, channelName string) (*gateway.Gateway, *gateway.Network) {
+	wallet, err := gateway.NewFileSystemWallet(filepath.Join(walletPath, label))
+	if err != nil {
+		log.Fatalf("Failed to create wallet: %v", err)
+	}
+	if !wallet.Exists(label) {
+		err := populateWallet(wallet, label)
+		if err != nil {
+			log.Fatalf("Failed to populate wallet contents: %v (run ./enrollIdentities.sh to enroll %s)", err, label)
+		}
+	}
+
+	gw, err := gateway.Connect(
+		gateway.WithConfig(config.FromFile(filepath.Clean(ccpPath))),
+		gateway.WithIdentity(wallet, label),
+	)
+	if err != nil {
+		log.Fatalf("Failed to connect to gateway: %v", err)
+	}
+
+	log.Println("--> Connecting to channel", channelName, "as", label)
+	network, err := gw.GetNetwork(channelName)
+	if err != nil {
+		log.Fatalf("Failed to get network: %v", err)
+	}
+	return gw, network
+}
+
+// populateWallet adds the Org1 user enrolled as name to the wallet under the
+// same label
+func populateWallet(wallet *gateway.Wallet, name string) error {
 	log.Println("============ Populating wallet ============")
 	credPath := filepath.Join(
 		"..",
@@ -172,7 +435,7 @@ func populateWallet(wallet *gateway.Wallet) error {
 		"peerOrganizations",
 		"org1.example.com",
 		"users",
-		"User1@org1.example.com",
+		name+"@org1.example.com",
 		"msp",
 	)
 
@@ -200,28 +463,93 @@ func populateWallet(wallet *gateway.Wallet) error {
 
 	identity := gateway.NewX509Identity("Org1MSP", string(cert), string(key))
 
-	return wallet.Put("appUser", identity)
+	return wallet.Put(name, identity)
+}
+
+func listenForEvents(notifier <-chan *fab.CCEvent) {
+	for ccEvent := range notifier {
+		var event Device_event
+		if err := json.Unmarshal(ccEvent.Payload, &event); err != nil {
+			log.Printf("Failed to parse %s event in tx %s: %v", ccEvent.EventName, ccEvent.TxID, err)
+			continue
+		}
+		switch {
+		case event.MerkleRoot != "":
+			log.Printf("<-- %s: root %s at %s (block %d)",
+				event.Event, event.MerkleRoot, event.Timestamp, ccEvent.BlockNumber)
+		case event.ProposalID != "" && event.OldStatus == "":
+			log.Printf("<-- %s: device %s in proposal %s at %s (block %d)",
+				event.Event, event.DeviceID, event.ProposalID, event.Timestamp, ccEvent.BlockNumber)
+		case event.Group != "":
+			log.Printf("<-- %s: %d devices of group %s -> %q at %s (block %d)",
+				event.Event, len(event.DeviceIDs), event.Group, event.NewStatus, event.Timestamp, ccEvent.BlockNumber)
+		case len(event.DeviceIDs) > 0:
+			log.Printf("<-- %s: %d devices at %s (block %d)",
+				event.Event, len(event.DeviceIDs), event.Timestamp, ccEvent.BlockNumber)
+		case event.ToMSP != "":
+			log.Printf("<-- %s: device %s %q -> %q at %s (block %d)",
+				event.Event, event.DeviceID, event.FromMSP, event.ToMSP, event.Timestamp, ccEvent.BlockNumber)
+		case event.SuspendedUntil != "":
+			log.Printf("<-- %s: device %s %q -> %q until %s (%s) at %s (block %d)",
+				event.Event, event.DeviceID, event.OldStatus, event.NewStatus, event.SuspendedUntil, event.SuspensionReason, event.Timestamp, ccEvent.BlockNumber)
+		case event.DeviceID == "":
+			log.Printf("<-- %s at %s (block %d)", event.Event, event.Timestamp, ccEvent.BlockNumber)
+		default:
+			log.Printf("<-- %s: device %s %q -> %q at %s (block %d)",
+				event.Event, event.DeviceID, event.OldStatus, event.NewStatus, event.Timestamp, ccEvent.BlockNumber)
+		}
+		if event.NewStatus == "suspended" || event.NewStatus == "revoked" {
+			if event.DeviceID != "" {
+				log.Printf("<-- Device %s is blacklisted", event.DeviceID)
+			}
+			for _, id := range event.DeviceIDs {
+				log.Printf("<-- Device %s is blacklisted", id)
+			}
+		}
+	}
 }
 
 func register(contract *gateway.Contract) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var requestBody struct {
-			Esp32ID string `json:"esp32id"`
-			Status  string `json:"Status"`
-			Key     string `json:"key"`
+			Esp32ID   string `json:"esp32id"`
+			Status    string `json:"Status"`
+			Key       string `json:"key"`
+			KeyType   string `json:"keyType"`
+			PublicKey string `json:"publicKey"`
+			Device_metadata
+			Device_validity
 		}
 		if err := c.BindJSON(&requestBody); err != nil {
 			c.JSON(400, gin.H{"error": "Invalid request body"})
 			return
 		}
+		metadata, err := json.Marshal(requestBody.Device_metadata)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid device metadata"})
+			return
+		}
 
-		if len(requestBody.Key) < 16 {
-			// Pad the Key with spaces to make it 16 characters
-			requestBody.Key = requestBody.Key + strings.Repeat(" ", 16-len(requestBody.Key))
+		var options []gateway.TransactionOption
+		if requestBody.KeyType == "" || strings.EqualFold(requestBody.KeyType, "aes") {
+			if len(requestBody.Key) < 16 {
+				// Pad the Key with spaces to make it 16 characters
+				requestBody.Key = requestBody.Key + strings.Repeat(" ", 16-len(requestBody.Key))
+			}
+
+			// The key travels in the transient map so that it stays out of the blocks
+			options = append(options, gateway.WithTransient(map[string][]byte{
+				"key": []byte(requestBody.Key),
+			}))
+		}
+		txn, err := contract.CreateTransaction("Register", options...)
+		if err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to create transaction: %s", err)})
+			return
 		}
 
 		// Submit transaction
-		_, err := contract.SubmitTransaction("Register", requestBody.Esp32ID, requestBody.Status, requestBody.Key)
+		_, err = txn.Submit(requestBody.Esp32ID, requestBody.Status, requestBody.KeyType, requestBody.PublicKey, string(metadata), requestBody.ValidFrom, requestBody.ValidUntil)
 		if err != nil {
 			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to submit transaction: %s", err)})
 			return
@@ -236,14 +564,24 @@ func update(contract *gateway.Contract) gin.HandlerFunc {
 		var requestBody struct {
 			Esp32ID string `json:"esp32id"`
 			Status  string `json:"Status"`
+			Device_metadata
 		}
 		if err := c.BindJSON(&requestBody); err != nil {
 			c.JSON(400, gin.H{"error": "Invalid request body"})
 			return
 		}
+		metadata := ""
+		if requestBody.Device_metadata != (Device_metadata{}) {
+			metadataJSON, err := json.Marshal(requestBody.Device_metadata)
+			if err != nil {
+				c.JSON(400, gin.H{"error": "Invalid device metadata"})
+				return
+			}
+			metadata = string(metadataJSON)
+		}
 
 		// Submit transaction
-		_, err := contract.SubmitTransaction("Update", requestBody.Esp32ID, requestBody.Status)
+		_, err := contract.SubmitTransaction("Update", requestBody.Esp32ID, requestBody.Status, metadata)
 		if err != nil {
 			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to submit transaction: %s", err)})
 			return
@@ -253,7 +591,7 @@ func update(contract *gateway.Contract) gin.HandlerFunc {
 	}
 }
 
-func auth(contract *gateway.Contract) gin.HandlerFunc {
+func auth(contract *gateway.Contract, peer string, nonces *nonceStore, attempts *attemptQueue) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Load .env file
 		er := godotenv.Load(".env")
@@ -262,67 +600,72 @@ func auth(contract *gateway.Contract) gin.HandlerFunc {
 		}
 		Key := os.Getenv("KEY")
 		var requestBody struct {
-			Esp32ID string `json:"esp32id"`
-			Cipher  string `json:"cipher"`
+			Esp32ID   string `json:"esp32id"`
+			Cipher    string `json:"cipher"`
+			Payload   string `json:"payload"`
+			Signature string `json:"signature"`
 		}
-		if err := c.BindJSON(&requestBody); err != nil {
+		if err := c.BindJSON(&requestBody); err != nil || requestBody.Esp32ID == "" {
 			c.JSON(400, gin.H{"error": "Invalid request body"})
 			return
 		}
 
-		// Submit transaction
-		asset, err := contract.SubmitTransaction("Auth", requestBody.Esp32ID)
+		// Every attempt is audited on the ledger, whatever its outcome. The
+		// record is queued so that the response does not wait for a commit.
+		outcome, reason, known := "failure", "", true
+		defer func() {
+			attempts.enqueue(requestBody.Esp32ID, known, outcome, reason)
+		}()
 
-		if err != nil {
-			c.JSON(500, gin.H{"error": fmt.Sprintf("%s", err)})
+		// The ledger only counts a failure once its record is committed, so
+		// failures still queued are counted here.
+		if attempts.blocked(requestBody.Esp32ID) {
+			reason = "too many failed authentications waiting to be recorded"
+			c.JSON(429, gin.H{"error": reason})
 			return
 		}
-		fmt.Println(string(asset))
-		m := make(map[string]string)
-		err = json.Unmarshal(asset, &m)
+
+		// Evaluate only: the result carries the device key, which must not be
+		// recorded in a block. Only the peers of the owning organization hold it.
+		txn, err := contract.CreateTransaction("Auth", gateway.WithEndorsingPeers(peer))
 		if err != nil {
+			reason = err.Error()
 			c.JSON(500, gin.H{"error": fmt.Sprintf("%s", err)})
 			return
 		}
-		var key = m["Key"]
-		fmt.Printf("Fetched Key is: %s\n", key)
+		asset, err := txn.Evaluate(requestBody.Esp32ID)
 
-		encryptedBytes, err := hex.DecodeString(requestBody.Cipher)
 		if err != nil {
+			reason, known = err.Error(), !unknownDevice(err, requestBody.Esp32ID)
 			c.JSON(500, gin.H{"error": fmt.Sprintf("%s", err)})
 			return
 		}
-
-		block, err := aes.NewCipher([]byte(key))
+		var credential Device_credential
+		err = json.Unmarshal(asset, &credential)
 		if err != nil {
+			reason = err.Error()
 			c.JSON(500, gin.H{"error": fmt.Sprintf("%s", err)})
 			return
 		}
 
-		// Trim any null characters used as padding
-		decrypted := make([]byte, len(encryptedBytes))
-		for bs, be := 0, block.BlockSize(); bs < len(encryptedBytes); bs, be = bs+be, be+be {
-			block.Decrypt(decrypted[bs:be], encryptedBytes[bs:be])
+		// AES devices encrypt the payload with the shared key, ECDSA and
+		// Ed25519 devices sign it. Either way it must carry a fresh nonce
+		// from /auth/challenge, which is then used up.
+		var answer *authPayload
+		if credential.KeyType == "" || strings.EqualFold(credential.KeyType, "aes") {
+			answer, err = verifyCipher(credential, requestBody.Cipher)
+		} else {
+			answer, err = verifySignature(credential, requestBody.Payload, requestBody.Signature)
 		}
-		decryptedText := string(decrypted)
-
-		fmt.Printf("Decrypted: %s\n", decryptedText)
-
-		// converting json here
-
-		var data map[string]string
-		if err := json.Unmarshal([]byte(decryptedText), &data); err != nil {
-			return
+		if err == nil {
+			err = nonces.consume(answer.Nonce, credential.ID, time.Unix(answer.Timestamp, 0))
 		}
-
-		// json convert end
-
-		fmt.Printf("Data: %v, ID: %s\n", data, data["id"])
-
-		if data["id"] != m["ID"] {
-			c.JSON(500, gin.H{"error": "Some error occurred"})
+		if err != nil {
+			reason = err.Error()
+			c.JSON(401, gin.H{"error": fmt.Sprintf("%s", err)})
 			return
 		}
+		outcome = "success"
 
 		url := "http://159.89.173.20:18083/api/v5/authentication/password_based%3Abuilt_in_database/users"
 		method := "POST"
@@ -388,43 +731,339 @@ func auth(contract *gateway.Contract) gin.HandlerFunc {
 	}
 }
 
-func delete(contract *gateway.Contract) gin.HandlerFunc {
+func authAttempts(contract *gateway.Contract) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result, err := contract.EvaluateTransaction("GetAuthAttempts", c.Param("id"), c.Query("from"), c.Query("to"))
+		if err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to evaluate transaction: %s", err)})
+			return
+		}
+		attempts := []Auth_attempt{}
+		if result != nil {
+			if err := json.Unmarshal(result, &attempts); err != nil {
+				c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to parse result: %s", err)})
+				return
+			}
+		}
+		c.JSON(200, gin.H{"attempts": attempts})
+	}
+}
+
+func lockout(contract *gateway.Contract) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result, err := contract.EvaluateTransaction("GetLockout", c.Param("id"))
+		if err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to evaluate transaction: %s", err)})
+			return
+		}
+		var lockout Lockout
+		if err := json.Unmarshal(result, &lockout); err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to parse result: %s", err)})
+			return
+		}
+		c.JSON(200, lockout)
+	}
+}
+
+func clearLockout(contract *gateway.Contract) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, err := contract.SubmitTransaction("ClearLockout", c.Param("id"))
+		if err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to submit transaction: %s", err)})
+			return
+		}
+
+		c.JSON(200, gin.H{"message": "Device lockout cleared"})
+	}
+}
+
+func transfer(contract *gateway.Contract) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var requestBody struct {
-			Esp32ID string `json:"esp32id"`
+			NewOwnerMSP string `json:"newOwnerMSP"`
 		}
 		if err := c.BindJSON(&requestBody); err != nil {
 			c.JSON(400, gin.H{"error": "Invalid request body"})
 			return
 		}
 
-		// Submit transaction
-		_, err := contract.SubmitTransaction("Delete", requestBody.Esp32ID)
+		_, err := contract.SubmitTransaction("TransferDevice", c.Param("id"), requestBody.NewOwnerMSP)
 		if err != nil {
 			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to submit transaction: %s", err)})
 			return
 		}
 
-		c.JSON(200, gin.H{"message": "Device deleted"})
+		c.JSON(200, gin.H{"message": "Device transfer submitted"})
 	}
 }
 
-func GetAll(contract *gateway.Contract) gin.HandlerFunc {
+func endorsement(contract *gateway.Contract) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		result, err = contract.EvaluateTransaction("GetAll")
+		result, err := contract.EvaluateTransaction("GetDeviceEndorsement", c.Param("id"))
+		if err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to evaluate transaction: %s", err)})
+			return
+		}
+		var endorsement Device_endorsement
+		if err := json.Unmarshal(result, &endorsement); err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to parse result: %s", err)})
+			return
+		}
+		c.JSON(200, endorsement)
+	}
+}
+
+func setEndorsement(contract *gateway.Contract) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var requestBody struct {
+			MSPIDs []string `json:"mspIds"`
+		}
+		if err := c.BindJSON(&requestBody); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid request body"})
+			return
+		}
+
+		_, err := contract.SubmitTransaction("SetDeviceEndorsement", c.Param("id"), strings.Join(requestBody.MSPIDs, ","))
 		if err != nil {
 			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to submit transaction: %s", err)})
 			return
 		}
-		var devices []Device_list
-		if result == nil {
-			c.JSON(200, gin.H{"devices": "No devices registered"})
+
+		c.JSON(200, gin.H{"message": "Device endorsement policy updated"})
+	}
+}
+
+func pendingTransfer(contract *gateway.Contract) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result, err := contract.EvaluateTransaction("GetPendingTransfer", c.Param("id"))
+		if err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to evaluate transaction: %s", err)})
+			return
+		}
+		var transfer Device_transfer
+		if err := json.Unmarshal(result, &transfer); err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to parse result: %s", err)})
 			return
 		}
+		c.JSON(200, transfer)
+	}
+}
+
+func acceptTransfer(contract *gateway.Contract) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, err := contract.SubmitTransaction("AcceptTransfer", c.Param("id"))
+		if err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to submit transaction: %s", err)})
+			return
+		}
+
+		c.JSON(200, gin.H{"message": "Device transfer accepted"})
+	}
+}
+
+func cancelTransfer(contract *gateway.Contract) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, err := contract.SubmitTransaction("CancelTransfer", c.Param("id"))
+		if err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to submit transaction: %s", err)})
+			return
+		}
+
+		c.JSON(200, gin.H{"message": "Device transfer cancelled"})
+	}
+}
+
+func rotateKey(contract *gateway.Contract) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var requestBody struct {
+			Key          string `json:"key"`
+			GraceSeconds int    `json:"graceSeconds"`
+		}
+		if err := c.BindJSON(&requestBody); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid request body"})
+			return
+		}
+
+		if len(requestBody.Key) < 16 {
+			// Pad the Key with spaces to make it 16 characters
+			requestBody.Key = requestBody.Key + strings.Repeat(" ", 16-len(requestBody.Key))
+		}
+
+		txn, err := contract.CreateTransaction("RotateKey", gateway.WithTransient(map[string][]byte{
+			"key": []byte(requestBody.Key),
+		}))
+		if err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to create transaction: %s", err)})
+			return
+		}
+
+		_, err = txn.Submit(c.Param("id"), strconv.Itoa(requestBody.GraceSeconds))
+		if err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to submit transaction: %s", err)})
+			return
+		}
+
+		c.JSON(200, gin.H{"message": "Device key rotated"})
+	}
+}
+
+func deleteDevice(contract *gateway.Contract) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var requestBody struct {
+			Esp32ID string `json:"esp32id"`
+			Reserve bool   `json:"reserve"`
+		}
+		if err := c.BindJSON(&requestBody); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid request body"})
+			return
+		}
+
+		// Deleting needs approvals; reserve keeps the ID from being registered again
+		submitProposal(c, contract, "ProposeDeletion", requestBody.Esp32ID, strconv.FormatBool(requestBody.Reserve))
+	}
+}
+
+func GetAll(contract *gateway.Contract) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		pageSize, paginated := c.GetQuery("pageSize")
+		if !paginated && c.Query("bookmark") == "" {
+			if status := c.Query("status"); status != "" {
+				listByStatus(c, contract, status)
+			} else {
+				getAllDevices(c, contract)
+			}
+			return
+		}
+		if !paginated {
+			pageSize = strconv.Itoa(defaultPageSize)
+		}
+		if _, err := strconv.ParseInt(pageSize, 10, 32); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid pageSize"})
+			return
+		}
+
+		result, err := contract.EvaluateTransaction("GetAllPaginated", pageSize, c.Query("bookmark"), c.Query("status"))
+		if err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to evaluate transaction: %s", err)})
+			return
+		}
+		var page Device_page
+		if err := json.Unmarshal(result, &page); err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to parse result: %s", err)})
+			return
+		}
+		c.JSON(200, page)
+	}
+}
+
+func getAllDevices(c *gin.Context, contract *gateway.Contract) {
+	result, err = contract.EvaluateTransaction("GetAll")
+	if err != nil {
+		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to submit transaction: %s", err)})
+		return
+	}
+	var devices []Device_list
+	if result == nil {
+		c.JSON(200, gin.H{"devices": "No devices registered"})
+		return
+	}
+	if err := json.Unmarshal(result, &devices); err != nil {
+		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to parse result: %s", err)})
+		return
+	}
+	c.JSON(200, gin.H{"devices": devices})
+}
+
+func listByStatus(c *gin.Context, contract *gateway.Contract, status string) {
+	result, err := contract.EvaluateTransaction("ListByStatus", status)
+	if err != nil {
+		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to evaluate transaction: %s", err)})
+		return
+	}
+	devices := []Device_list{}
+	if result != nil {
 		if err := json.Unmarshal(result, &devices); err != nil {
 			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to parse result: %s", err)})
 			return
 		}
-		c.JSON(200, gin.H{"devices": devices})
+	}
+	c.JSON(200, gin.H{"devices": devices})
+}
+
+func statuses(contract *gateway.Contract) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result, err := contract.EvaluateTransaction("GetStatuses")
+		if err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to evaluate transaction: %s", err)})
+			return
+		}
+		var statuses []Status_info
+		if err := json.Unmarshal(result, &statuses); err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to parse result: %s", err)})
+			return
+		}
+		c.JSON(200, gin.H{"statuses": statuses})
+	}
+}
+
+func history(contract *gateway.Contract) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result, err := contract.EvaluateTransaction("GetDeviceHistory", c.Param("id"))
+		if err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to evaluate transaction: %s", err)})
+			return
+		}
+		var entries []History_entry
+		if err := json.Unmarshal(result, &entries); err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to parse result: %s", err)})
+			return
+		}
+		c.JSON(200, gin.H{"history": entries})
+	}
+}
+
+func revocations(contract *gateway.Contract) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result, err := contract.EvaluateTransaction("GetRevocationList")
+		if err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to evaluate transaction: %s", err)})
+			return
+		}
+		var list Revocation_list
+		if err := json.Unmarshal(result, &list); err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to parse result: %s", err)})
+			return
+		}
+		c.JSON(200, list)
+	}
+}
+
+func query(contract *gateway.Contract) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var requestBody struct {
+			Selector json.RawMessage `json:"selector"`
+			PageSize int32           `json:"pageSize"`
+			Bookmark string          `json:"bookmark"`
+		}
+		if err := c.BindJSON(&requestBody); err != nil || len(requestBody.Selector) == 0 {
+			c.JSON(400, gin.H{"error": "Invalid request body"})
+			return
+		}
+		if requestBody.PageSize <= 0 {
+			requestBody.PageSize = defaultPageSize
+		}
+
+		result, err := contract.EvaluateTransaction("QueryDevices", string(requestBody.Selector),
+			strconv.Itoa(int(requestBody.PageSize)), requestBody.Bookmark)
+		if err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to evaluate transaction: %s", err)})
+			return
+		}
+		var page Device_page
+		if err := json.Unmarshal(result, &page); err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to parse result: %s", err)})
+			return
+		}
+		c.JSON(200, page)
 	}
 }
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+)
+
+// Proposal is a device deletion or reactivation waiting for approvals from
+// distinct admins. It is carried out once Threshold admins approved it.
+type Proposal struct {
+	ID         string   `json:"id"`
+	Action     string   `json:"action"`
+	DeviceID   string   `json:"deviceId"`
+	Reserve    bool     `json:"reserve,omitempty"`
+	Threshold  int      `json:"threshold"`
+	Approvals  []string `json:"approvals"`
+	State      string   `json:"state"`
+	ProposedBy string   `json:"proposedBy"`
+	ProposedAt string   `json:"proposedAt"`
+	ExpiresAt  string   `json:"expiresAt"`
+	ExecutedAt string   `json:"executedAt,omitempty"`
+}
+
+func reactivate(contract *gateway.Contract) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		submitProposal(c, contract, "ProposeReactivation", c.Param("id"))
+	}
+}
+
+func approveProposal(contract *gateway.Contract) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		submitProposal(c, contract, "ApproveProposal", c.Param("id"))
+	}
+}
+
+func proposals(contract *gateway.Contract) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result, err := contract.EvaluateTransaction("GetPendingProposals")
+		if err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to evaluate transaction: %s", err)})
+			return
+		}
+		var proposals []Proposal
+		if err := json.Unmarshal(result, &proposals); err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to parse result: %s", err)})
+			return
+		}
+
+		c.JSON(200, proposals)
+	}
+}
+
+func proposal(contract *gateway.Contract) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result, err := contract.EvaluateTransaction("GetProposal", c.Param("id"))
+		if err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to evaluate transaction: %s", err)})
+			return
+		}
+		var proposal Proposal
+		if err := json.Unmarshal(result, &proposal); err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to parse result: %s", err)})
+			return
+		}
+
+		c.JSON(200, proposal)
+	}
+}
+
+// submitProposal submits a transaction that creates or approves a proposal
+// and reports whether the change was carried out
+func submitProposal(c *gin.Context, contract *gateway.Contract, name string, args ...string) {
+	result, err := contract.SubmitTransaction(name, args...)
+	if err != nil {
+		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to submit transaction: %s", err)})
+		return
+	}
+	var proposal Proposal
+	if err := json.Unmarshal(result, &proposal); err != nil {
+		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to parse result: %s", err)})
+		return
+	}
+
+	message := fmt.Sprintf("Proposal to %s device %s has %d of %d approvals", proposal.Action, proposal.DeviceID, len(proposal.Approvals), proposal.Threshold)
+	if proposal.State == "executed" {
+		message = fmt.Sprintf("Proposal to %s device %s approved and executed", proposal.Action, proposal.DeviceID)
+	}
+	c.JSON(200, gin.H{"message": message, "proposal": proposal})
+}
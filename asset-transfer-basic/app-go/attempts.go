@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/status"
+	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+)
+
+// maxQueuedAttempts bounds the attempts waiting to be recorded. Once it is
+// reached an attempt on a registered device drops the oldest attempt on an
+// unknown one, or else the oldest queued attempt, and an attempt on an
+// unknown device is dropped.
+const maxQueuedAttempts = 10000
+
+// maxUnknownDevices bounds the unknown device IDs with attempts waiting to be
+// recorded. Further attempts on an ID already queued are counted into its
+// record, so that made-up IDs cannot flood the queue; attempts on other
+// unknown IDs are dropped.
+const maxUnknownDevices = 1000
+
+// Delays between retries of an attempt the ledger could not take, doubling
+// from minRetryDelay up to maxRetryDelay
+const (
+	minRetryDelay = time.Second
+	maxRetryDelay = time.Minute
+)
+
+type queuedAttempt struct {
+	DeviceID string    `json:"deviceId"`
+	Outcome  string    `json:"outcome"`
+	Reason   string    `json:"reason,omitempty"`
+	QueuedAt time.Time `json:"queuedAt"`
+	// Unknown marks an attempt on a device the ledger does not know; Count
+	// and LastAt sum up the attempts on it counted into this record
+	Unknown bool      `json:"unknown,omitempty"`
+	Count   int       `json:"count,omitempty"`
+	LastAt  time.Time `json:"lastAt,omitempty"`
+}
+
+// reason returns the reason recorded on the ledger, noting how many attempts
+// the record stands for
+func (attempt *queuedAttempt) reason() string {
+	if attempt.Count <= 1 {
+		return attempt.Reason
+	}
+	return fmt.Sprintf("%d attempts until %s: %s", attempt.Count, attempt.LastAt.UTC().Format(time.RFC3339), attempt.Reason)
+}
+
+// attemptQueue records authentication attempts on the ledger in the
+// background, so that /auth answers without waiting for a commit. Attempts
+// are submitted one at a time in the order they were made, which keeps the
+// failure counts of the chaincode right, and retried until the ledger takes
+// them. The queue is written to a JSON file so that attempts survive an app
+// restart.
+//
+// Since the failure counter of the chaincode only moves once a record is
+// committed, the queue also counts the failures of each device still waiting
+// to be recorded, and /auth refuses a device once that count reaches the
+// limit instead of letting guesses pile up behind the queue.
+type attemptQueue struct {
+	mu       sync.Mutex
+	path     string
+	contract *gateway.Contract
+	attempts []queuedAttempt
+	wake     chan struct{}
+	limit    int
+	failures map[string]int
+}
+
+// newAttemptQueue loads the attempts saved at path, if any, and starts
+// submitting them through contract. A device is refused once limit of its
+// failures wait to be recorded.
+func newAttemptQueue(path string, contract *gateway.Contract, limit int) (*attemptQueue, error) {
+	q := &attemptQueue{path: path, contract: contract, wake: make(chan struct{}, 1), limit: limit, failures: make(map[string]int)}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &q.attempts); err != nil {
+			return nil, fmt.Errorf("failed to parse attempt queue %s: %v", path, err)
+		}
+		log.Printf("--> %d authentication attempts left to record", len(q.attempts))
+		for _, attempt := range q.attempts {
+			q.count(attempt, 1)
+		}
+	}
+
+	go q.run()
+	return q, nil
+}
+
+// blocked reports whether too many failures of a device wait to be recorded
+func (q *attemptQueue) blocked(deviceID string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.failures[deviceID] >= q.limit
+}
+
+// count adds delta to the pending failures of the device of attempt if it
+// is a failure on a registered device; the caller must hold the lock
+func (q *attemptQueue) count(attempt queuedAttempt, delta int) {
+	if attempt.Unknown || attempt.Outcome != "failure" {
+		return
+	}
+	if q.failures[attempt.DeviceID] += delta; q.failures[attempt.DeviceID] <= 0 {
+		delete(q.failures, attempt.DeviceID)
+	}
+}
+
+// enqueue queues an attempt to be recorded. known tells whether the ledger
+// knows the device.
+func (q *attemptQueue) enqueue(deviceID string, known bool, outcome string, reason string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.add(queuedAttempt{DeviceID: deviceID, Outcome: outcome, Reason: reason, QueuedAt: time.Now(), Unknown: !known}) {
+		return
+	}
+	if err := q.save(); err != nil {
+		log.Printf("%v", err)
+	}
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// add puts an attempt into the queue and reports whether the queue changed;
+// the caller must hold the lock. The oldest attempt is never touched, since
+// run may be submitting it.
+func (q *attemptQueue) add(attempt queuedAttempt) bool {
+	if attempt.Unknown {
+		unknown := 0
+		for i := 1; i < len(q.attempts); i++ {
+			queued := &q.attempts[i]
+			if !queued.Unknown {
+				continue
+			}
+			if queued.DeviceID == attempt.DeviceID {
+				if queued.Count == 0 {
+					queued.Count = 1
+				}
+				queued.Count++
+				queued.LastAt = attempt.QueuedAt
+				return true
+			}
+			unknown++
+		}
+		if unknown >= maxUnknownDevices || len(q.attempts) >= maxQueuedAttempts {
+			log.Printf("Attempt queue is full, dropped the attempt on the unknown device %s", attempt.DeviceID)
+			return false
+		}
+	}
+
+	if len(q.attempts) >= maxQueuedAttempts {
+		drop := 1
+		for i := 1; i < len(q.attempts); i++ {
+			if q.attempts[i].Unknown {
+				drop = i
+				break
+			}
+		}
+		dropped := q.attempts[drop]
+		q.attempts = append(q.attempts[:drop], q.attempts[drop+1:]...)
+		q.count(dropped, -1)
+		log.Printf("Attempt queue is full, dropped the attempt of %s queued at %s", dropped.DeviceID, dropped.QueuedAt.Format(time.RFC3339))
+	}
+	q.attempts = append(q.attempts, attempt)
+	q.count(attempt, 1)
+	return true
+}
+
+// run submits the queued attempts, oldest first, waiting for new ones when
+// the queue is empty
+func (q *attemptQueue) run() {
+	delay := minRetryDelay
+	for {
+		attempt, ok := q.next()
+		if !ok {
+			<-q.wake
+			continue
+		}
+
+		_, err := q.contract.SubmitTransaction("RecordAuthAttempt", attempt.DeviceID, attempt.Outcome, attempt.reason(), attempt.QueuedAt.UTC().Format(time.RFC3339Nano))
+		if err != nil && !rejected(err) {
+			log.Printf("Failed to record authentication attempt of %s, retrying in %s: %v", attempt.DeviceID, delay, err)
+			time.Sleep(delay)
+			if delay *= 2; delay > maxRetryDelay {
+				delay = maxRetryDelay
+			}
+			continue
+		}
+		if err != nil {
+			log.Printf("The ledger refused the authentication attempt of %s: %v", attempt.DeviceID, err)
+		}
+		delay = minRetryDelay
+		q.done()
+	}
+}
+
+// next returns the oldest queued attempt
+func (q *attemptQueue) next() (queuedAttempt, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.attempts) == 0 {
+		return queuedAttempt{}, false
+	}
+	return q.attempts[0], true
+}
+
+// done removes the oldest queued attempt once it has been handled
+func (q *attemptQueue) done() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.count(q.attempts[0], -1)
+	q.attempts = q.attempts[1:]
+	if err := q.save(); err != nil {
+		log.Printf("%v", err)
+	}
+}
+
+// save writes the queue to disk through a temporary file so that a crash
+// never leaves a truncated file; the caller must hold the lock
+func (q *attemptQueue) save() error {
+	data, err := json.Marshal(q.attempts)
+	if err != nil {
+		return err
+	}
+	tmp := q.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to save attempt queue: %v", err)
+	}
+	if err := os.Rename(tmp, q.path); err != nil {
+		return fmt.Errorf("failed to save attempt queue: %v", err)
+	}
+	return nil
+}
+
+// unknownDevice reports whether err is the chaincode refusing the device id
+// because it is not registered
+func unknownDevice(err error, id string) bool {
+	return err != nil && strings.Contains(err.Error(), fmt.Sprintf("the device %s does not exist", id))
+}
+
+// rejected reports whether the chaincode itself refused a transaction,
+// which retrying does not change, as opposed to a failure to reach the
+// network or a conflict with a concurrent transaction
+func rejected(err error) bool {
+	s, ok := status.FromError(err)
+	if !ok {
+		return false
+	}
+	if s.Group == status.ChaincodeStatus {
+		return true
+	}
+	for _, detail := range s.Details {
+		if detailErr, ok := detail.(error); ok && rejected(detailErr) {
+			return true
+		}
+	}
+	return false
+}
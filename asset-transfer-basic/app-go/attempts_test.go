@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTestQueue returns a queue that is not connected to the ledger
+func newTestQueue(t *testing.T) *attemptQueue {
+	return &attemptQueue{path: filepath.Join(t.TempDir(), "attempts.json"), limit: 2, failures: make(map[string]int)}
+}
+
+func TestAttemptQueueCountsUnknownDevices(t *testing.T) {
+	q := newTestQueue(t)
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.True(t, q.add(queuedAttempt{DeviceID: "D1", Outcome: "failure", QueuedAt: at}))
+	for i := 0; i < 3; i++ {
+		require.True(t, q.add(queuedAttempt{DeviceID: "X1", Outcome: "failure", Reason: "unknown", QueuedAt: at.Add(time.Duration(i) * time.Second), Unknown: true}))
+	}
+
+	require.Len(t, q.attempts, 2)
+	require.Equal(t, 3, q.attempts[1].Count)
+	require.Equal(t, "3 attempts until 2024-01-01T00:00:02Z: unknown", q.attempts[1].reason())
+	require.Equal(t, at, q.attempts[1].QueuedAt)
+
+	// the oldest record may be in flight and is left alone
+	q = newTestQueue(t)
+	require.True(t, q.add(queuedAttempt{DeviceID: "X1", QueuedAt: at, Unknown: true}))
+	require.True(t, q.add(queuedAttempt{DeviceID: "X1", QueuedAt: at, Unknown: true}))
+	require.Len(t, q.attempts, 2)
+	require.Zero(t, q.attempts[0].Count)
+}
+
+func TestAttemptQueueKeepsKnownDevices(t *testing.T) {
+	q := newTestQueue(t)
+	for i := 0; i < maxUnknownDevices+1; i++ {
+		q.add(queuedAttempt{DeviceID: fmt.Sprintf("X%d", i), Unknown: true})
+	}
+	require.Len(t, q.attempts, maxUnknownDevices+1, "the oldest record is not counted")
+	require.False(t, q.add(queuedAttempt{DeviceID: "X-new", Unknown: true}))
+
+	for len(q.attempts) < maxQueuedAttempts {
+		require.True(t, q.add(queuedAttempt{DeviceID: "D1"}))
+	}
+	// a full queue makes room for a registered device by dropping an
+	// unknown one, and never the other way round
+	require.True(t, q.add(queuedAttempt{DeviceID: "D2"}))
+	require.Len(t, q.attempts, maxQueuedAttempts)
+	require.Equal(t, "X0", q.attempts[0].DeviceID)
+	require.Equal(t, "X2", q.attempts[1].DeviceID)
+	require.Equal(t, "D2", q.attempts[len(q.attempts)-1].DeviceID)
+	require.False(t, q.add(queuedAttempt{DeviceID: "X-new", Unknown: true}))
+	require.True(t, q.add(queuedAttempt{DeviceID: "X2", Unknown: true}))
+	require.Len(t, q.attempts, maxQueuedAttempts)
+	require.Equal(t, 2, q.attempts[1].Count)
+}
+
+func TestAttemptQueueBlocksPendingFailures(t *testing.T) {
+	q := newTestQueue(t)
+	q.add(queuedAttempt{DeviceID: "D1", Outcome: "success"})
+	q.add(queuedAttempt{DeviceID: "D1", Outcome: "failure"})
+	q.add(queuedAttempt{DeviceID: "X1", Outcome: "failure", Unknown: true})
+	q.add(queuedAttempt{DeviceID: "X1", Outcome: "failure", Unknown: true})
+	require.False(t, q.blocked("D1"))
+	require.False(t, q.blocked("X1"))
+
+	q.add(queuedAttempt{DeviceID: "D1", Outcome: "failure"})
+	require.True(t, q.blocked("D1"))
+	require.False(t, q.blocked("D2"))
+
+	// the device is let through again as its failures are recorded
+	q.done()
+	q.done()
+	require.False(t, q.blocked("D1"))
+	require.Equal(t, map[string]int{"D1": 1}, q.failures)
+}
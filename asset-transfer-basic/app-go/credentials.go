@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+)
+
+// authPayload is what a device encrypts or signs to answer a challenge: its
+// ID, the nonce issued by /auth/challenge and its clock as unix seconds
+type authPayload struct {
+	ID        string `json:"id"`
+	Nonce     string `json:"nonce"`
+	Timestamp int64  `json:"ts"`
+}
+
+// parsePayload parses a decrypted or signed payload and checks that it
+// names the device
+func parsePayload(data []byte, deviceID string) (*authPayload, error) {
+	var payload authPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, fmt.Errorf("failed to parse payload: %v", err)
+	}
+	if payload.ID != deviceID {
+		return nil, fmt.Errorf("the payload does not match device %s", deviceID)
+	}
+	if payload.Nonce == "" || payload.Timestamp == 0 {
+		return nil, fmt.Errorf("the payload must carry a nonce and a timestamp")
+	}
+	return &payload, nil
+}
+
+// verifyCipher decrypts the cipher with the current key of the device or,
+// during the grace window of a key rotation, with its previous key
+func verifyCipher(credential Device_credential, cipherHex string) (*authPayload, error) {
+	keys := []string{credential.Key}
+	if credential.PreviousKey != "" {
+		keys = append(keys, credential.PreviousKey)
+	}
+
+	var err error
+	for _, key := range keys {
+		var decrypted []byte
+		if decrypted, err = decryptPayload(key, cipherHex); err != nil {
+			continue
+		}
+		var payload *authPayload
+		if payload, err = parsePayload(decrypted, credential.ID); err == nil {
+			return payload, nil
+		}
+	}
+	return nil, err
+}
+
+// verifySignature checks the hex encoded signature of the device over the
+// payload. ECDSA signatures are ASN.1 encoded over the SHA-256 digest of the
+// payload, Ed25519 signatures cover the payload itself.
+func verifySignature(credential Device_credential, payload string, signatureHex string) (*authPayload, error) {
+	signature, err := hex.DecodeString(signatureHex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature encoding: %v", err)
+	}
+
+	block, _ := pem.Decode([]byte(credential.PublicKey))
+	if block == nil {
+		return nil, fmt.Errorf("device %s has no valid public key", credential.ID)
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key of device %s: %v", credential.ID, err)
+	}
+
+	valid := false
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256([]byte(payload))
+		valid = ecdsa.VerifyASN1(key, digest[:], signature)
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(key, []byte(payload), signature)
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+	if !valid {
+		return nil, fmt.Errorf("invalid signature for device %s", credential.ID)
+	}
+
+	return parsePayload([]byte(payload), credential.ID)
+}
+
+// decryptPayload decrypts the AES-ECB ciphertext sent by a device
+func decryptPayload(key string, cipherHex string) ([]byte, error) {
+	encryptedBytes, err := hex.DecodeString(cipherHex)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher([]byte(key))
+	if err != nil {
+		return nil, err
+	}
+	if len(encryptedBytes)%block.BlockSize() != 0 {
+		return nil, fmt.Errorf("cipher length must be a multiple of %d bytes", block.BlockSize())
+	}
+
+	decrypted := make([]byte, len(encryptedBytes))
+	for bs := 0; bs < len(encryptedBytes); bs += block.BlockSize() {
+		block.Decrypt(decrypted[bs:bs+block.BlockSize()], encryptedBytes[bs:bs+block.BlockSize()])
+	}
+	// Trim any null characters used as padding
+	return bytes.TrimRight(decrypted, "\x00"), nil
+}
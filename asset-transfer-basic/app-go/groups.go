@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+)
+
+type Device_group struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	CreatedBy   string `json:"createdBy"`
+	CreatedAt   string `json:"createdAt"`
+}
+type Skipped_device struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+type Group_status_result struct {
+	Group   string           `json:"group"`
+	Status  string           `json:"status"`
+	Updated []string         `json:"updated"`
+	Skipped []Skipped_device `json:"skipped"`
+}
+
+func createGroup(contract *gateway.Contract) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var requestBody struct {
+			Name        string `json:"name"`
+			Description string `json:"description"`
+		}
+		if err := c.BindJSON(&requestBody); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid request body"})
+			return
+		}
+
+		_, err := contract.SubmitTransaction("CreateGroup", requestBody.Name, requestBody.Description)
+		if err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to submit transaction: %s", err)})
+			return
+		}
+
+		c.JSON(200, gin.H{"message": "Group created"})
+	}
+}
+
+func deleteGroup(contract *gateway.Contract) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, err := contract.SubmitTransaction("DeleteGroup", c.Param("name"))
+		if err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to submit transaction: %s", err)})
+			return
+		}
+
+		c.JSON(200, gin.H{"message": "Group deleted"})
+	}
+}
+
+func groups(contract *gateway.Contract) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result, err := contract.EvaluateTransaction("GetGroups")
+		if err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to evaluate transaction: %s", err)})
+			return
+		}
+		groups := []Device_group{}
+		if len(result) > 0 {
+			if err := json.Unmarshal(result, &groups); err != nil {
+				c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to parse result: %s", err)})
+				return
+			}
+		}
+		c.JSON(200, groups)
+	}
+}
+
+func groupMembers(contract *gateway.Contract) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result, err := contract.EvaluateTransaction("GetGroupMembers", c.Param("name"))
+		if err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to evaluate transaction: %s", err)})
+			return
+		}
+		devices := []Device_list{}
+		if err := json.Unmarshal(result, &devices); err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to parse result: %s", err)})
+			return
+		}
+		c.JSON(200, devices)
+	}
+}
+
+// changeMembers adds or removes the devices listed in the request body,
+// depending on the chaincode function it is given
+func changeMembers(contract *gateway.Contract, function string, message string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var requestBody struct {
+			Esp32IDs []string `json:"esp32ids"`
+		}
+		if err := c.BindJSON(&requestBody); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid request body"})
+			return
+		}
+
+		_, err := contract.SubmitTransaction(function, c.Param("name"), strings.Join(requestBody.Esp32IDs, ","))
+		if err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to submit transaction: %s", err)})
+			return
+		}
+
+		c.JSON(200, gin.H{"message": message})
+	}
+}
+
+func groupStatus(contract *gateway.Contract) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var requestBody struct {
+			Status string `json:"Status"`
+		}
+		if err := c.BindJSON(&requestBody); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid request body"})
+			return
+		}
+
+		result, err := contract.SubmitTransaction("SetGroupStatus", c.Param("name"), requestBody.Status)
+		if err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to submit transaction: %s", err)})
+			return
+		}
+		var status Group_status_result
+		if err := json.Unmarshal(result, &status); err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to parse result: %s", err)})
+			return
+		}
+		c.JSON(200, status)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+)
+
+// identities holds a gateway connection per device admin the application
+// acts for. Each admin logs in with a token of their own, which the logins
+// file maps to their wallet identity, so that changes needing several
+// approvals, such as deleting a device, are approved by each admin through
+// their own identity and no caller can act as another admin.
+type identities struct {
+	labels    []string
+	contracts map[string]*gateway.Contract
+	// logins maps the hex SHA-256 of a login token to a wallet label
+	logins map[string]string
+}
+
+// loadLogins reads the logins file written by enrollIdentities.sh. Each line
+// holds a wallet label and the hex SHA-256 of the login token of its admin;
+// the tokens themselves are only held by the admins.
+func loadLogins(path string) (*identities, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	ids := &identities{contracts: make(map[string]*gateway.Contract), logins: make(map[string]string)}
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected a wallet label and a token hash", path, line)
+		}
+		label, hash := fields[0], strings.ToLower(fields[1])
+		if sum, err := hex.DecodeString(hash); err != nil || len(sum) != sha256.Size {
+			return nil, fmt.Errorf("%s:%d: invalid SHA-256 token hash", path, line)
+		}
+		if other, ok := ids.logins[hash]; ok {
+			return nil, fmt.Errorf("%s:%d: %s shares a login token with %s", path, line, label, other)
+		}
+		ids.logins[hash] = label
+		if !seen[label] {
+			seen[label] = true
+			ids.labels = append(ids.labels, label)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids.labels) == 0 {
+		return nil, fmt.Errorf("%s has no logins", path)
+	}
+	return ids, nil
+}
+
+// add makes the contract of the wallet identity label available
+func (ids *identities) add(label string, contract *gateway.Contract) {
+	ids.contracts[label] = contract
+}
+
+// login returns the wallet label of the admin whose token the request
+// carries as a bearer token
+func (ids *identities) login(c *gin.Context) (string, bool) {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if token == "" || token == c.GetHeader("Authorization") {
+		return "", false
+	}
+	sum := sha256.Sum256([]byte(token))
+	label, ok := ids.logins[hex.EncodeToString(sum[:])]
+	return label, ok
+}
+
+// handle builds the handler of newHandler for every identity and serves each
+// request with the one of the admin who logged in with it
+func (ids *identities) handle(newHandler func(contract *gateway.Contract) gin.HandlerFunc) gin.HandlerFunc {
+	handlers := make(map[string]gin.HandlerFunc, len(ids.labels))
+	for _, label := range ids.labels {
+		handlers[label] = newHandler(ids.contracts[label])
+	}
+
+	return func(c *gin.Context) {
+		label, ok := ids.login(c)
+		if !ok {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.JSON(401, gin.H{"error": "A valid admin login token is required"})
+			return
+		}
+		handlers[label](c)
+	}
+}
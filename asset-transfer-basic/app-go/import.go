@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+)
+
+// Import_row is one device of an import, read from a CSV row or a JSON object
+type Import_row struct {
+	Esp32ID   string `json:"esp32id"`
+	Status    string `json:"Status"`
+	Key       string `json:"key"`
+	KeyType   string `json:"keyType"`
+	PublicKey string `json:"publicKey"`
+	Device_metadata
+	Device_validity
+}
+
+// Import_result reports what happened to one row of an import
+type Import_result struct {
+	Row     int    `json:"row"`
+	Esp32ID string `json:"esp32id"`
+	Result  string `json:"result"`
+	Error   string `json:"error,omitempty"`
+}
+
+type registration struct {
+	ID        string `json:"ID"`
+	Status    string `json:"Status"`
+	KeyType   string `json:"KeyType,omitempty"`
+	PublicKey string `json:"PublicKey,omitempty"`
+	Device_metadata
+	Device_validity
+}
+
+// importPlan is an import split into the rows already rejected and the
+// batch of registrations to check with the chaincode
+type importPlan struct {
+	results []Import_result
+	batch   []registration
+	// batchRows holds the row index of each registration of batch
+	batchRows []int
+	// keys holds the AES key of each registration of batch by device ID
+	keys map[string]string
+}
+
+type batchIssue struct {
+	Index int    `json:"Index"`
+	ID    string `json:"ID"`
+	Error string `json:"Error"`
+}
+
+// importDevices registers many devices at once from a CSV file (Content-Type
+// text/csv, with a header row) or a JSON array. Rows the chaincode would
+// reject are reported and skipped; the others are registered in a single
+// RegisterBatch transaction.
+func importDevices(contract *gateway.Contract) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rows []Import_row
+		var err error
+		if strings.Contains(c.ContentType(), "csv") {
+			rows, err = parseImportCSV(c.Request.Body)
+		} else {
+			err = json.NewDecoder(c.Request.Body).Decode(&rows)
+		}
+		if err != nil {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("Invalid import: %s", err)})
+			return
+		}
+		if len(rows) == 0 {
+			c.JSON(400, gin.H{"error": "No devices to import"})
+			return
+		}
+
+		plan := planImport(rows)
+		results, batch, batchRows, keys := plan.results, plan.batch, plan.batchRows, plan.keys
+
+		registered := 0
+		if len(batch) > 0 {
+			batchJSON, err := json.Marshal(batch)
+			if err != nil {
+				c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to encode devices: %s", err)})
+				return
+			}
+			keysJSON, err := json.Marshal(keys)
+			if err != nil {
+				c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to encode keys: %s", err)})
+				return
+			}
+			transient := gateway.WithTransient(map[string][]byte{"keys": keysJSON})
+
+			// Ask the chaincode which rows it would reject before submitting,
+			// since RegisterBatch rejects the whole batch on any bad row
+			txn, err := contract.CreateTransaction("CheckBatch", transient)
+			if err != nil {
+				c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to create transaction: %s", err)})
+				return
+			}
+			result, err := txn.Evaluate(string(batchJSON))
+			if err != nil {
+				c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to evaluate transaction: %s", err)})
+				return
+			}
+			var issues []batchIssue
+			if len(result) > 0 {
+				if err := json.Unmarshal(result, &issues); err != nil {
+					c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to parse result: %s", err)})
+					return
+				}
+			}
+
+			rejected := map[int]bool{}
+			for _, issue := range issues {
+				if issue.Index < 0 || issue.Index >= len(batchRows) {
+					continue
+				}
+				rejected[issue.Index] = true
+				results[batchRows[issue.Index]].Result = "rejected"
+				results[batchRows[issue.Index]].Error = issue.Error
+			}
+
+			var accepted []registration
+			var acceptedRows []int
+			acceptedKeys := map[string]string{}
+			for i, device := range batch {
+				if rejected[i] {
+					continue
+				}
+				accepted = append(accepted, device)
+				acceptedRows = append(acceptedRows, batchRows[i])
+				if key, ok := keys[device.ID]; ok {
+					acceptedKeys[device.ID] = key
+				}
+			}
+
+			if len(accepted) > 0 {
+				registered, err = submitBatch(contract, accepted, acceptedKeys)
+				for _, row := range acceptedRows {
+					if err != nil {
+						results[row].Result = "rejected"
+						results[row].Error = err.Error()
+					} else {
+						results[row].Result = "registered"
+					}
+				}
+			}
+		}
+
+		c.JSON(200, gin.H{"registered": registered, "results": results})
+	}
+}
+
+// planImport rejects the rows that have no device ID or repeat the ID of an
+// earlier row, and turns the others into a batch. Only the first row of a
+// device is kept, so that a later duplicate cannot replace its key.
+func planImport(rows []Import_row) *importPlan {
+	plan := &importPlan{results: make([]Import_result, len(rows)), keys: map[string]string{}}
+	firstRows := map[string]int{}
+	for i, row := range rows {
+		plan.results[i] = Import_result{Row: i + 1, Esp32ID: row.Esp32ID}
+		if row.Esp32ID == "" {
+			plan.results[i].Result = "rejected"
+			plan.results[i].Error = "missing esp32id"
+			continue
+		}
+		if first, ok := firstRows[row.Esp32ID]; ok {
+			plan.results[i].Result = "rejected"
+			plan.results[i].Error = fmt.Sprintf("duplicate of row %d", first+1)
+			continue
+		}
+		firstRows[row.Esp32ID] = i
+
+		if row.KeyType == "" || strings.EqualFold(row.KeyType, "aes") {
+			if len(row.Key) < 16 {
+				// Pad the Key with spaces to make it 16 characters
+				row.Key = row.Key + strings.Repeat(" ", 16-len(row.Key))
+			}
+			plan.keys[row.Esp32ID] = row.Key
+		}
+		plan.batch = append(plan.batch, registration{
+			ID:              row.Esp32ID,
+			Status:          row.Status,
+			KeyType:         row.KeyType,
+			PublicKey:       row.PublicKey,
+			Device_metadata: row.Device_metadata,
+			Device_validity: row.Device_validity,
+		})
+		plan.batchRows = append(plan.batchRows, i)
+	}
+	return plan
+}
+
+// submitBatch registers the devices with RegisterBatch and returns how many were written
+func submitBatch(contract *gateway.Contract, devices []registration, keys map[string]string) (int, error) {
+	devicesJSON, err := json.Marshal(devices)
+	if err != nil {
+		return 0, err
+	}
+	keysJSON, err := json.Marshal(keys)
+	if err != nil {
+		return 0, err
+	}
+
+	txn, err := contract.CreateTransaction("RegisterBatch", gateway.WithTransient(map[string][]byte{"keys": keysJSON}))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create transaction: %s", err)
+	}
+	result, err := txn.Submit(string(devicesJSON))
+	if err != nil {
+		return 0, fmt.Errorf("failed to submit transaction: %s", err)
+	}
+
+	var registered int
+	if err := json.Unmarshal(result, &registered); err != nil {
+		return 0, fmt.Errorf("failed to parse result: %s", err)
+	}
+	return registered, nil
+}
+
+// parseImportCSV reads import rows from CSV with a header naming the columns
+// esp32id (or id), status, key, keyType, publicKey, model, firmware, owner,
+// site, mac, tags, validFrom and validUntil in any order. Tags are separated
+// by semicolons.
+func parseImportCSV(body io.Reader) ([]Import_row, error) {
+	reader := csv.NewReader(body)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %s", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "id" {
+			name = "esp32id"
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["esp32id"]; !ok {
+		return nil, fmt.Errorf("the CSV header must have an esp32id column")
+	}
+
+	var rows []Import_row
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV: %s", err)
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		optional := func(name string) *string {
+			if value := field(name); value != "" {
+				return &value
+			}
+			return nil
+		}
+		row := Import_row{
+			Esp32ID:   field("esp32id"),
+			Status:    field("status"),
+			Key:       field("key"),
+			KeyType:   field("keytype"),
+			PublicKey: field("publickey"),
+			Device_metadata: Device_metadata{
+				Model:    optional("model"),
+				Firmware: optional("firmware"),
+				Owner:    optional("owner"),
+				Site:     optional("site"),
+				MAC:      optional("mac"),
+			},
+			Device_validity: Device_validity{
+				ValidFrom:  field("validfrom"),
+				ValidUntil: field("validuntil"),
+			},
+		}
+		if tags := field("tags"); tags != "" {
+			list := strings.Split(tags, ";")
+			row.Tags = &list
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanImportKeepsFirstDuplicate(t *testing.T) {
+	rows, err := parseImportCSV(strings.NewReader("esp32id,status,key\n" +
+		"D1,active,0123456789abcdef\n" +
+		",active,0123456789abcdef\n" +
+		"D2,active,short\n" +
+		"D1,active,fedcba9876543210\n"))
+	require.NoError(t, err)
+
+	plan := planImport(rows)
+	require.Equal(t, []int{0, 2}, plan.batchRows)
+	require.Len(t, plan.batch, 2)
+	require.Equal(t, "D1", plan.batch[0].ID)
+	require.Equal(t, "D2", plan.batch[1].ID)
+	require.Equal(t, map[string]string{
+		"D1": "0123456789abcdef",
+		"D2": "short           ",
+	}, plan.keys)
+
+	require.Equal(t, Import_result{Row: 2, Result: "rejected", Error: "missing esp32id"}, plan.results[1])
+	require.Equal(t, Import_result{Row: 4, Esp32ID: "D1", Result: "rejected", Error: "duplicate of row 1"}, plan.results[3])
+	require.Empty(t, plan.results[0].Result)
+}
+
+func TestPlanImportPublicKeys(t *testing.T) {
+	plan := planImport([]Import_row{
+		{Esp32ID: "E1", Status: "active", KeyType: "Ed25519", PublicKey: "pem"},
+		{Esp32ID: "A1", Status: "active", KeyType: "AES", Key: "0123456789abcdef"},
+	})
+	require.Equal(t, map[string]string{"A1": "0123456789abcdef"}, plan.keys)
+	require.Equal(t, "pem", plan.batch[0].PublicKey)
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+)
+
+// maxPendingNonces bounds the unanswered nonces kept per device; issuing
+// another one evicts the oldest
+const maxPendingNonces = 5
+
+// maxNonces bounds the unanswered nonces of all devices. Once it is reached
+// issuing another one evicts the nonce closest to expiring.
+const maxNonces = 10000
+
+// nonceStore tracks the single-use nonces issued to devices in a directory,
+// one file per nonce named after the nonce and the device, expiring at the
+// modification time of the file. Every instance of the app serving /auth
+// shares the directory, for example on a common volume: consuming a nonce
+// removes its file, which only one instance can do, so a nonce is accepted
+// once whichever instance issued or checks it.
+type nonceStore struct {
+	mu  sync.Mutex
+	dir string
+	ttl time.Duration
+}
+
+// issuedNonce is a nonce file found in the store
+type issuedNonce struct {
+	name      string
+	deviceID  string
+	expiresAt time.Time
+}
+
+// newNonceStore opens the nonce directory at dir, creating it if needed, and
+// drops the expired nonces in it
+func newNonceStore(dir string, ttl time.Duration) (*nonceStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	s := &nonceStore{dir: dir, ttl: ttl}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.pending(time.Now())
+	return s, err
+}
+
+// issue creates a random nonce for the device
+func (s *nonceStore) issue(deviceID string) (string, time.Time, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", time.Time{}, err
+	}
+	nonce := hex.EncodeToString(random)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	pending, err := s.pending(now)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	var own []issuedNonce
+	for _, issued := range pending {
+		if issued.deviceID == deviceID {
+			own = append(own, issued)
+		}
+	}
+	if len(own) >= maxPendingNonces {
+		s.remove(own[0])
+	} else if len(pending) >= maxNonces {
+		s.remove(pending[0])
+	}
+
+	expiresAt := now.Add(s.ttl)
+	path := filepath.Join(s.dir, nonceFile(nonce, deviceID))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to store nonce: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to store nonce: %v", err)
+	}
+	if err := os.Chtimes(path, now, expiresAt); err != nil {
+		os.Remove(path)
+		return "", time.Time{}, fmt.Errorf("failed to store nonce: %v", err)
+	}
+	return nonce, expiresAt, nil
+}
+
+// consume accepts a nonce once, provided it was issued to the device, has not
+// expired and the device timestamp is within the nonce lifetime of now
+func (s *nonceStore) consume(nonce string, deviceID string, timestamp time.Time) error {
+	if raw, err := hex.DecodeString(nonce); err != nil || len(raw) != 16 {
+		return fmt.Errorf("unknown or already used nonce")
+	}
+	path := filepath.Join(s.dir, nonceFile(nonce, deviceID))
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unknown or already used nonce")
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if expiresAt := info.ModTime(); now.After(expiresAt) {
+		os.Remove(path)
+		return fmt.Errorf("nonce expired at %s", expiresAt.UTC().Format(time.RFC3339))
+	}
+	if skew := now.Sub(timestamp); skew > s.ttl || skew < -s.ttl {
+		return fmt.Errorf("timestamp %s is too far from server time", timestamp.Format(time.RFC3339))
+	}
+
+	// another instance may consume the same nonce at the same time; only
+	// the one removing the file accepts it
+	if err := os.Remove(path); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unknown or already used nonce")
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// pending drops the expired nonces and returns the others, the ones closest
+// to expiring first; the caller must hold the lock
+func (s *nonceStore) pending(now time.Time) ([]issuedNonce, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read nonce store: %v", err)
+	}
+
+	var pending []issuedNonce
+	for _, entry := range entries {
+		_, deviceID, ok := parseNonceFile(entry.Name())
+		if !ok {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// consumed by another instance meanwhile
+			continue
+		}
+		issued := issuedNonce{name: entry.Name(), deviceID: deviceID, expiresAt: info.ModTime()}
+		if now.After(issued.expiresAt) {
+			s.remove(issued)
+			continue
+		}
+		pending = append(pending, issued)
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].expiresAt.Before(pending[j].expiresAt)
+	})
+	return pending, nil
+}
+
+// remove deletes a nonce from the store
+func (s *nonceStore) remove(issued issuedNonce) {
+	if err := os.Remove(filepath.Join(s.dir, issued.name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Failed to remove nonce: %v", err)
+	}
+}
+
+// nonceFile names the file of a nonce; the device ID is hex encoded so that
+// any ID makes a valid file name
+func nonceFile(nonce string, deviceID string) string {
+	return nonce + "." + hex.EncodeToString([]byte(deviceID))
+}
+
+// parseNonceFile splits a file name made by nonceFile
+func parseNonceFile(name string) (string, string, bool) {
+	dot := strings.IndexByte(name, '.')
+	if dot < 0 {
+		return "", "", false
+	}
+	deviceID, err := hex.DecodeString(name[dot+1:])
+	if err != nil {
+		return "", "", false
+	}
+	return name[:dot], string(deviceID), true
+}
+
+// challenge issues a nonce to a registered device that may authenticate,
+// which Auth tells without the app keeping the key it returns
+func challenge(contract *gateway.Contract, peer string, nonces *nonceStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var requestBody struct {
+			Esp32ID string `json:"esp32id"`
+		}
+		if err := c.BindJSON(&requestBody); err != nil || requestBody.Esp32ID == "" {
+			c.JSON(400, gin.H{"error": "Invalid request body"})
+			return
+		}
+
+		txn, err := contract.CreateTransaction("Auth", gateway.WithEndorsingPeers(peer))
+		if err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("%s", err)})
+			return
+		}
+		if _, err := txn.Evaluate(requestBody.Esp32ID); err != nil {
+			c.JSON(403, gin.H{"error": fmt.Sprintf("The device may not authenticate: %s", err)})
+			return
+		}
+
+		nonce, expiresAt, err := nonces.issue(requestBody.Esp32ID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to issue nonce: %s", err)})
+			return
+		}
+
+		c.JSON(200, gin.H{"nonce": nonce, "expiresAt": expiresAt.UTC().Format(time.RFC3339)})
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNonceReuse(t *testing.T) {
+	dir := t.TempDir()
+	nonces, err := newNonceStore(dir, time.Minute)
+	require.NoError(t, err)
+	nonce, expiresAt, err := nonces.issue("D1")
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now().Add(time.Minute), expiresAt, time.Second)
+
+	require.EqualError(t, nonces.consume(nonce, "D2", time.Now()), "unknown or already used nonce")
+	stale := time.Now().Add(-time.Hour)
+	require.EqualError(t, nonces.consume(nonce, "D1", stale), "timestamp "+stale.Format(time.RFC3339)+" is too far from server time")
+	require.NoError(t, nonces.consume(nonce, "D1", time.Now()))
+	require.EqualError(t, nonces.consume(nonce, "D1", time.Now()), "unknown or already used nonce")
+
+	// another instance sharing the directory sees the same nonces
+	nonce, _, err = nonces.issue("D1")
+	require.NoError(t, err)
+	other, err := newNonceStore(dir, time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, other.consume(nonce, "D1", time.Now()))
+	require.Error(t, nonces.consume(nonce, "D1", time.Now()))
+
+	require.Error(t, nonces.consume("../../etc/passwd", "D1", time.Now()))
+}
+
+func TestNonceExpiry(t *testing.T) {
+	dir := t.TempDir()
+	nonces, err := newNonceStore(dir, time.Minute)
+	require.NoError(t, err)
+	nonce, _, err := nonces.issue("D1")
+	require.NoError(t, err)
+	past := time.Now().Add(-time.Second)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, nonceFile(nonce, "D1")), past, past))
+
+	require.EqualError(t, nonces.consume(nonce, "D1", time.Now()), "nonce expired at "+past.UTC().Format(time.RFC3339))
+	require.EqualError(t, nonces.consume(nonce, "D1", time.Now()), "unknown or already used nonce")
+
+	// expired nonces are dropped before any pending one
+	expired, _, err := nonces.issue("D2")
+	require.NoError(t, err)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, nonceFile(expired, "D2")), past, past))
+	pending, err := nonces.pending(time.Now())
+	require.NoError(t, err)
+	require.Empty(t, pending)
+}
+
+func TestNonceLimits(t *testing.T) {
+	nonces, err := newNonceStore(t.TempDir(), time.Minute)
+	require.NoError(t, err)
+	var issued []string
+	for i := 0; i < maxPendingNonces+1; i++ {
+		nonce, _, err := nonces.issue("D1")
+		require.NoError(t, err)
+		issued = append(issued, nonce)
+	}
+	other, _, err := nonces.issue("D2")
+	require.NoError(t, err)
+
+	pending, err := nonces.pending(time.Now())
+	require.NoError(t, err)
+	require.Len(t, pending, maxPendingNonces+1)
+	require.Error(t, nonces.consume(issued[0], "D1", time.Now()), "the oldest nonce of the device makes room")
+	require.NoError(t, nonces.consume(issued[maxPendingNonces], "D1", time.Now()))
+	require.NoError(t, nonces.consume(other, "D2", time.Now()))
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+)
+
+// Revocation_snapshot is the revocation snapshot anchored on the ledger with
+// an inclusion proof for each entry. An offline gateway that trusts Root,
+// which it can establish from Anchor without trusting this application,
+// can refuse a device by checking its proof with verifyInclusion.
+type Revocation_snapshot struct {
+	Root       string           `json:"root"`
+	Count      int              `json:"count"`
+	AnchoredAt string           `json:"anchoredAt"`
+	AnchoredBy string           `json:"anchoredBy"`
+	TxID       string           `json:"txId"`
+	Anchor     *Snapshot_anchor `json:"anchor,omitempty"`
+	Entries    []Snapshot_entry `json:"entries"`
+}
+
+// Snapshot_anchor is the transaction TxID that anchored the snapshot, as
+// committed in block BlockNumber. Each endorsement signs Payload followed by
+// its Endorser bytes; Payload is the ProposalResponsePayload whose chaincode
+// response, Result, is the anchored snapshot and so carries the root. A
+// verifier checks the signatures against the CAs of the organizations, that
+// the endorsers satisfy the endorsement policy and that the root in Result
+// is the one it was given.
+type Snapshot_anchor struct {
+	TxID           string                 `json:"txId"`
+	BlockNumber    uint64                 `json:"blockNumber"`
+	ValidationCode string                 `json:"validationCode"`
+	Payload        string                 `json:"payload"`
+	Result         string                 `json:"result"`
+	Endorsements   []Snapshot_endorsement `json:"endorsements"`
+}
+
+// Snapshot_endorsement is one endorsement of the anchoring transaction.
+// Endorser and Signature are base64 as they appear in the block; MSPID and
+// Certificate are decoded from Endorser for convenience.
+type Snapshot_endorsement struct {
+	MSPID       string `json:"mspId"`
+	Certificate string `json:"certificate"`
+	Endorser    string `json:"endorser"`
+	Signature   string `json:"signature"`
+}
+type Snapshot_entry struct {
+	ID     string       `json:"id"`
+	Reason string       `json:"reason"`
+	Proof  []Proof_step `json:"proof"`
+}
+
+// Proof_step is one sibling on the path from a leaf to the root. Position
+// tells whether the sibling is hashed to the left or to the right.
+type Proof_step struct {
+	Hash     string `json:"hash"`
+	Position string `json:"position"`
+}
+
+func anchorSnapshot(contract *gateway.Contract) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result, err := contract.SubmitTransaction("AnchorRevocationSnapshot")
+		if err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to submit transaction: %s", err)})
+			return
+		}
+		var snapshot Revocation_snapshot
+		if err := json.Unmarshal(result, &snapshot); err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to parse result: %s", err)})
+			return
+		}
+		c.JSON(200, gin.H{"root": snapshot.Root, "count": snapshot.Count, "anchoredAt": snapshot.AnchoredAt, "txId": snapshot.TxID})
+	}
+}
+
+// revocationSnapshot serves the last anchored snapshot with inclusion
+// proofs and the anchoring transaction read from the ledger of channelName
+// through qscc, or only the entry of one device when the id query is set
+func revocationSnapshot(contract *gateway.Contract, qscc *gateway.Contract, channelName string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result, err := contract.EvaluateTransaction("GetRevocationSnapshot")
+		if err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to evaluate transaction: %s", err)})
+			return
+		}
+		var snapshot Revocation_snapshot
+		if err := json.Unmarshal(result, &snapshot); err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to parse result: %s", err)})
+			return
+		}
+		if err := addProofs(&snapshot); err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Invalid revocation snapshot: %s", err)})
+			return
+		}
+		if snapshot.TxID != "" {
+			anchor, err := snapshotAnchor(qscc, channelName, snapshot.TxID, snapshot.Root)
+			if err != nil {
+				c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to read anchoring transaction %s: %s", snapshot.TxID, err)})
+				return
+			}
+			snapshot.Anchor = anchor
+		}
+
+		if id := c.Query("id"); id != "" {
+			for _, entry := range snapshot.Entries {
+				if entry.ID == id {
+					snapshot.Entries = []Snapshot_entry{entry}
+					c.JSON(200, snapshot)
+					return
+				}
+			}
+			c.JSON(404, gin.H{"error": fmt.Sprintf("Device %s is not in the revocation snapshot", id)})
+			return
+		}
+		c.JSON(200, snapshot)
+	}
+}
+
+// snapshotAnchor reads transaction txID and the number of its block from the
+// ledger and checks that it validly anchored root
+func snapshotAnchor(qscc *gateway.Contract, channelName string, txID string, root string) (*Snapshot_anchor, error) {
+	result, err := qscc.EvaluateTransaction("GetTransactionByID", channelName, txID)
+	if err != nil {
+		return nil, err
+	}
+	processed := &peer.ProcessedTransaction{}
+	if err := proto.Unmarshal(result, processed); err != nil {
+		return nil, fmt.Errorf("failed to parse transaction: %v", err)
+	}
+	anchor := &Snapshot_anchor{
+		TxID:           txID,
+		ValidationCode: peer.TxValidationCode(processed.ValidationCode).String(),
+	}
+	if processed.ValidationCode != int32(peer.TxValidationCode_VALID) {
+		return nil, fmt.Errorf("the transaction is %s", anchor.ValidationCode)
+	}
+
+	result, err = qscc.EvaluateTransaction("GetBlockByTxID", channelName, txID)
+	if err != nil {
+		return nil, err
+	}
+	block := &common.Block{}
+	if err := proto.Unmarshal(result, block); err != nil {
+		return nil, fmt.Errorf("failed to parse block: %v", err)
+	}
+	anchor.BlockNumber = block.Header.Number
+
+	payload := &common.Payload{}
+	if err := proto.Unmarshal(processed.TransactionEnvelope.GetPayload(), payload); err != nil {
+		return nil, fmt.Errorf("failed to parse transaction payload: %v", err)
+	}
+	transaction := &peer.Transaction{}
+	if err := proto.Unmarshal(payload.Data, transaction); err != nil {
+		return nil, fmt.Errorf("failed to parse transaction: %v", err)
+	}
+	if len(transaction.Actions) != 1 {
+		return nil, fmt.Errorf("expected one action, found %d", len(transaction.Actions))
+	}
+	actionPayload := &peer.ChaincodeActionPayload{}
+	if err := proto.Unmarshal(transaction.Actions[0].Payload, actionPayload); err != nil {
+		return nil, fmt.Errorf("failed to parse action: %v", err)
+	}
+	endorsed := actionPayload.GetAction()
+	responsePayload := &peer.ProposalResponsePayload{}
+	if err := proto.Unmarshal(endorsed.GetProposalResponsePayload(), responsePayload); err != nil {
+		return nil, fmt.Errorf("failed to parse proposal response: %v", err)
+	}
+	action := &peer.ChaincodeAction{}
+	if err := proto.Unmarshal(responsePayload.Extension, action); err != nil {
+		return nil, fmt.Errorf("failed to parse chaincode action: %v", err)
+	}
+
+	var anchored Revocation_snapshot
+	if err := json.Unmarshal(action.GetResponse().GetPayload(), &anchored); err != nil {
+		return nil, fmt.Errorf("failed to parse the anchored snapshot: %v", err)
+	}
+	if anchored.Root != root {
+		return nil, fmt.Errorf("the transaction anchored root %s, not %s", anchored.Root, root)
+	}
+	anchor.Payload = base64.StdEncoding.EncodeToString(endorsed.ProposalResponsePayload)
+	anchor.Result = string(action.Response.Payload)
+
+	for _, endorsement := range endorsed.Endorsements {
+		endorser := &msp.SerializedIdentity{}
+		if err := proto.Unmarshal(endorsement.Endorser, endorser); err != nil {
+			return nil, fmt.Errorf("failed to parse endorser: %v", err)
+		}
+		anchor.Endorsements = append(anchor.Endorsements, Snapshot_endorsement{
+			MSPID:       endorser.Mspid,
+			Certificate: string(endorser.IdBytes),
+			Endorser:    base64.StdEncoding.EncodeToString(endorsement.Endorser),
+			Signature:   base64.StdEncoding.EncodeToString(endorsement.Signature),
+		})
+	}
+	return anchor, nil
+}
+
+// addProofs rebuilds the Merkle tree of the snapshot, checks it against the
+// anchored root and fills in the proof of every entry
+func addProofs(snapshot *Revocation_snapshot) error {
+	levels := [][][]byte{{}}
+	for _, entry := range snapshot.Entries {
+		levels[0] = append(levels[0], snapshotLeaf(entry.ID, entry.Reason))
+	}
+	for len(levels[len(levels)-1]) > 1 {
+		level := levels[len(levels)-1]
+		var next [][]byte
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+			} else {
+				next = append(next, snapshotNode(level[i], level[i+1]))
+			}
+		}
+		levels = append(levels, next)
+	}
+
+	root := sha256.Sum256(nil)
+	computed := root[:]
+	if top := levels[len(levels)-1]; len(top) == 1 {
+		computed = top[0]
+	}
+	if hex.EncodeToString(computed) != snapshot.Root {
+		return fmt.Errorf("the entries hash to %x, not to the anchored root %s", computed, snapshot.Root)
+	}
+
+	for i := range snapshot.Entries {
+		proof := []Proof_step{}
+		index := i
+		for _, level := range levels[:len(levels)-1] {
+			if index%2 == 1 {
+				proof = append(proof, Proof_step{Hash: hex.EncodeToString(level[index-1]), Position: "left"})
+			} else if index+1 < len(level) {
+				proof = append(proof, Proof_step{Hash: hex.EncodeToString(level[index+1]), Position: "right"})
+			}
+			index /= 2
+		}
+		snapshot.Entries[i].Proof = proof
+		if !verifyInclusion(snapshot.Root, snapshot.Entries[i]) {
+			return fmt.Errorf("the proof of device %s does not verify", snapshot.Entries[i].ID)
+		}
+	}
+	return nil
+}
+
+// verifyInclusion reports whether the proof of entry leads to root. This is
+// the check an offline gateway runs before refusing a device.
+func verifyInclusion(root string, entry Snapshot_entry) bool {
+	expected, err := hex.DecodeString(root)
+	if err != nil {
+		return false
+	}
+	hash := snapshotLeaf(entry.ID, entry.Reason)
+	for _, step := range entry.Proof {
+		sibling, err := hex.DecodeString(step.Hash)
+		if err != nil {
+			return false
+		}
+		switch step.Position {
+		case "left":
+			hash = snapshotNode(sibling, hash)
+		case "right":
+			hash = snapshotNode(hash, sibling)
+		default:
+			return false
+		}
+	}
+	return bytes.Equal(hash, expected)
+}
+
+// snapshotLeaf is SHA-256(0x00 || id || 0x00 || reason), as in the chaincode
+func snapshotLeaf(id string, reason string) []byte {
+	hash := sha256.Sum256([]byte("\x00" + id + "\x00" + reason))
+	return hash[:]
+}
+
+// snapshotNode is SHA-256(0x01 || left || right), as in the chaincode
+func snapshotNode(left []byte, right []byte) []byte {
+	hash := sha256.New()
+	hash.Write([]byte{1})
+	hash.Write(left)
+	hash.Write(right)
+	return hash.Sum(nil)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// merkleRoot computes the root of the leaves the way the chaincode does,
+// carrying the last node of an odd level up unchanged
+func merkleRoot(level [][]byte) []byte {
+	if len(level) == 0 {
+		empty := sha256.Sum256(nil)
+		return empty[:]
+	}
+	for len(level) > 1 {
+		var next [][]byte
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+			} else {
+				next = append(next, snapshotNode(level[i], level[i+1]))
+			}
+		}
+		level = next
+	}
+	return level[0]
+}
+
+func testSnapshot(count int) *Revocation_snapshot {
+	snapshot := &Revocation_snapshot{Count: count, Entries: []Snapshot_entry{}}
+	var leaves [][]byte
+	for i := 0; i < count; i++ {
+		entry := Snapshot_entry{ID: fmt.Sprintf("D%d", i), Reason: "revoked"}
+		snapshot.Entries = append(snapshot.Entries, entry)
+		leaves = append(leaves, snapshotLeaf(entry.ID, entry.Reason))
+	}
+	snapshot.Root = hex.EncodeToString(merkleRoot(leaves))
+	return snapshot
+}
+
+func TestAddProofs(t *testing.T) {
+	for count := 0; count <= 9; count++ {
+		snapshot := testSnapshot(count)
+		require.NoError(t, addProofs(snapshot), "%d entries", count)
+		for _, entry := range snapshot.Entries {
+			require.True(t, verifyInclusion(snapshot.Root, entry), "%s of %d entries", entry.ID, count)
+		}
+	}
+
+	// the last entry of an odd level is carried up without a sibling
+	snapshot := testSnapshot(5)
+	require.NoError(t, addProofs(snapshot))
+	require.Len(t, snapshot.Entries[4].Proof, 1)
+	require.Equal(t, "left", snapshot.Entries[4].Proof[0].Position)
+	require.Len(t, snapshot.Entries[0].Proof, 3)
+}
+
+func TestAddProofsRejectsOtherRoot(t *testing.T) {
+	snapshot := testSnapshot(3)
+	snapshot.Entries = snapshot.Entries[:2]
+	require.Error(t, addProofs(snapshot))
+}
+
+func TestVerifyInclusionRejectsTampering(t *testing.T) {
+	snapshot := testSnapshot(7)
+	require.NoError(t, addProofs(snapshot))
+
+	entry := snapshot.Entries[6]
+	entry.Reason = "decommissioned"
+	require.False(t, verifyInclusion(snapshot.Root, entry))
+
+	entry = snapshot.Entries[3]
+	entry.Proof = append([]Proof_step{}, entry.Proof...)
+	entry.Proof[0].Position = "right"
+	require.False(t, verifyInclusion(snapshot.Root, entry))
+	entry.Proof[0].Position = "up"
+	require.False(t, verifyInclusion(snapshot.Root, entry))
+
+	require.False(t, verifyInclusion("not hex", snapshot.Entries[0]))
+	require.False(t, verifyInclusion(testSnapshot(6).Root, snapshot.Entries[0]))
+}
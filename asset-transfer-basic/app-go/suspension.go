@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+)
+
+// Device_suspension suspends a device until an RFC3339 time, for instance
+// for a maintenance window. Reason is a short code such as "maintenance".
+type Device_suspension struct {
+	Until  string `json:"until"`
+	Reason string `json:"reason"`
+}
+
+func suspend(contract *gateway.Contract) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var requestBody Device_suspension
+		if err := c.BindJSON(&requestBody); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid request body"})
+			return
+		}
+
+		_, err := contract.SubmitTransaction("Suspend", c.Param("id"), requestBody.Until, requestBody.Reason)
+		if err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to submit transaction: %s", err)})
+			return
+		}
+
+		c.JSON(200, gin.H{"message": fmt.Sprintf("Device suspended until %s", requestBody.Until)})
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+)
+
+// defaultExpiryDays is the window of /devices/expiring when no days are given
+const defaultExpiryDays = 30
+
+// Device_validity bounds the period in which a device may authenticate, as
+// RFC3339 timestamps. An empty end leaves the period open on that side.
+type Device_validity struct {
+	ValidFrom  string `json:"validFrom,omitempty"`
+	ValidUntil string `json:"validUntil,omitempty"`
+}
+
+func setValidity(contract *gateway.Contract) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var requestBody Device_validity
+		if err := c.BindJSON(&requestBody); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid request body"})
+			return
+		}
+
+		_, err := contract.SubmitTransaction("SetDeviceValidity", c.Param("id"), requestBody.ValidFrom, requestBody.ValidUntil)
+		if err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to submit transaction: %s", err)})
+			return
+		}
+
+		c.JSON(200, gin.H{"message": "Device validity updated"})
+	}
+}
+
+func expiringDevices(contract *gateway.Contract) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		days := strconv.Itoa(defaultExpiryDays)
+		if value, ok := c.GetQuery("days"); ok {
+			if _, err := strconv.Atoi(value); err != nil {
+				c.JSON(400, gin.H{"error": "Invalid days"})
+				return
+			}
+			days = value
+		}
+
+		result, err := contract.EvaluateTransaction("GetExpiringDevices", days)
+		if err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to evaluate transaction: %s", err)})
+			return
+		}
+		var devices []Device_list
+		if err := json.Unmarshal(result, &devices); err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to parse result: %s", err)})
+			return
+		}
+		c.JSON(200, devices)
+	}
+}
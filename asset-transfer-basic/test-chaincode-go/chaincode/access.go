@@ -0,0 +1,152 @@
+package chaincode
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// AccessPolicy describes which client identities may invoke a class of
+// transactions. An empty MSPIDs list admits every MSP and an empty
+// Attributes map requires no certificate attributes.
+type AccessPolicy struct {
+	MSPIDs     []string          `json:"MSPIDs"`
+	Attributes map[string]string `json:"Attributes,omitempty" metadata:",optional"`
+}
+
+// DefaultReadPolicy lets any member of the device operator orgs query devices
+var DefaultReadPolicy = AccessPolicy{
+	MSPIDs: []string{"Org1MSP", "Org2MSP"},
+}
+
+// DefaultWritePolicy additionally requires the role=device-admin attribute
+// in the invoker's certificate to change device state
+var DefaultWritePolicy = AccessPolicy{
+	MSPIDs:     []string{"Org1MSP", "Org2MSP"},
+	Attributes: map[string]string{"role": "device-admin"},
+}
+
+// DefaultAdminPolicy guards the transactions that change how devices are
+// governed rather than the devices themselves, such as their endorsement
+// policies. It requires the role=ledger-admin attribute.
+var DefaultAdminPolicy = AccessPolicy{
+	MSPIDs:     []string{"Org1MSP", "Org2MSP"},
+	Attributes: map[string]string{"role": "ledger-admin"},
+}
+
+// DefaultGatewayPolicy guards Auth, which hands out device credentials. It
+// requires the role=device-gateway attribute carried by the identities of
+// the authentication gateways.
+var DefaultGatewayPolicy = AccessPolicy{
+	MSPIDs:     []string{"Org1MSP", "Org2MSP"},
+	Attributes: map[string]string{"role": "device-gateway"},
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// check returns an error describing why the identity does not satisfy the policy
+func (p AccessPolicy) check(identity cid.ClientIdentity, action string) error {
+	mspID, err := identity.GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to read client MSP ID: %v", err)
+	}
+
+	if len(p.MSPIDs) > 0 && !contains(p.MSPIDs, mspID) {
+		return fmt.Errorf("access denied: clients of %s are not allowed to %s devices", mspID, action)
+	}
+
+	for name, want := range p.Attributes {
+		got, found, err := identity.GetAttributeValue(name)
+		if err != nil {
+			return fmt.Errorf("failed to read client attribute %s: %v", name, err)
+		}
+		if !found || got != want {
+			return fmt.Errorf("access denied: the attribute %s=%s is required to %s devices", name, want, action)
+		}
+	}
+
+	return nil
+}
+
+func contains(items []string, item string) bool {
+	for _, candidate := range items {
+		if candidate == item {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeRead enforces the read policy on the invoking client
+func (s *SmartContract) authorizeRead(ctx contractapi.TransactionContextInterface) error {
+	config, err := readConfig(ctx)
+	if err != nil {
+		return err
+	}
+	return config.readPolicy().check(ctx.GetClientIdentity(), "read")
+}
+
+// authorizeWrite enforces the write policy on the invoking client
+func (s *SmartContract) authorizeWrite(ctx contractapi.TransactionContextInterface) error {
+	config, err := readConfig(ctx)
+	if err != nil {
+		return err
+	}
+	return config.writePolicy().check(ctx.GetClientIdentity(), "modify")
+}
+
+// authorizeAdmin enforces the admin policy on the invoking client
+func (s *SmartContract) authorizeAdmin(ctx contractapi.TransactionContextInterface) error {
+	config, err := readConfig(ctx)
+	if err != nil {
+		return err
+	}
+	return config.adminPolicy().check(ctx.GetClientIdentity(), "administer")
+}
+
+// authorizeGateway enforces the gateway policy on the invoking client
+func (s *SmartContract) authorizeGateway(ctx contractapi.TransactionContextInterface) error {
+	config, err := readConfig(ctx)
+	if err != nil {
+		return err
+	}
+	return config.gatewayPolicy().check(ctx.GetClientIdentity(), "authenticate")
+}
+
+// invokerMSP returns the MSP ID of the invoking client
+func invokerMSP(ctx contractapi.TransactionContextInterface) (string, error) {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return "", fmt.Errorf("failed to read client MSP ID: %v", err)
+	}
+	return mspID, nil
+}
+
+// invokerID returns a readable identifier for the invoking client made of its
+// MSP ID and the subject and issuer of its certificate
+func invokerID(ctx contractapi.TransactionContextInterface) (string, error) {
+	mspID, err := invokerMSP(ctx)
+	if err != nil {
+		return "", err
+	}
+	id, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to read client ID: %v", err)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(id)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode client ID: %v", err)
+	}
+	return mspID + "/" + string(decoded), nil
+}
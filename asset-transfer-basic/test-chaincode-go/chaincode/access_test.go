@@ -0,0 +1,38 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessPolicies(t *testing.T) {
+	l := newLedger(t)
+	l.register("D1")
+
+	getAll := func() error {
+		return l.evaluate(func(ctx contractapi.TransactionContextInterface) error {
+			_, err := l.contract.GetAll(ctx)
+			return err
+		})
+	}
+	l.as(org3Admin)
+	require.EqualError(t, getAll(), "access denied: clients of Org3MSP are not allowed to read devices")
+
+	l.configure(chaincode.Config{ReadPolicy: &chaincode.AccessPolicy{MSPIDs: []string{"Org3MSP"}}})
+	require.NoError(t, getAll())
+
+	l.configure(chaincode.Config{GatewayPolicy: &chaincode.AccessPolicy{MSPIDs: []string{"Org1MSP"}, Attributes: map[string]string{"role": "device-admin"}}})
+	_, err := l.authAs(org1Admin, "D1")
+	require.NoError(t, err)
+	_, err = l.auth("D1")
+	require.EqualError(t, err, "access denied: the attribute role=device-admin is required to authenticate devices")
+
+	l.configure(chaincode.Config{WritePolicy: &chaincode.AccessPolicy{Attributes: map[string]string{"role": "operator"}}})
+	err = l.as(org1Admin).submit(func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.Update(ctx, "D1", chaincode.StatusSuspended, "")
+	})
+	require.EqualError(t, err, "access denied: the attribute role=operator is required to modify devices")
+}
@@ -0,0 +1,320 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// proposalIndex is the composite key object type of the change proposals
+const proposalIndex = "proposal~id"
+
+// Approval defaults used when the Config does not set them
+const (
+	DefaultApprovalThreshold = 2
+	DefaultProposalLifetime  = 72 * time.Hour
+)
+
+// Changes that need approval
+const (
+	ActionDelete     = "delete"
+	ActionReactivate = "reactivate"
+)
+
+// Proposal states. A pending proposal past ExpiresAt is reported as expired.
+const (
+	ProposalPending  = "pending"
+	ProposalExecuted = "executed"
+	ProposalExpired  = "expired"
+)
+
+// Proposal is a sensitive change to a device waiting for approvals from
+// distinct clients. The proposer's approval counts, and the change is
+// carried out by the approval that reaches Threshold.
+type Proposal struct {
+	ID         string   `json:"ID"`
+	Action     string   `json:"Action"`
+	DeviceID   string   `json:"DeviceID"`
+	Reserve    bool     `json:"Reserve,omitempty" metadata:",optional"`
+	Threshold  int      `json:"Threshold"`
+	Approvals  []string `json:"Approvals"`
+	State      string   `json:"State"`
+	ProposedBy string   `json:"ProposedBy"`
+	ProposedAt string   `json:"ProposedAt"`
+	ExpiresAt  string   `json:"ExpiresAt"`
+	ExecutedAt string   `json:"ExecutedAt,omitempty" metadata:",optional"`
+}
+
+// ProposeDeletion proposes to delete a device, reserving its ID when
+// reserve is set. The ID of the proposal is the ID of this transaction.
+func (s *SmartContract) ProposeDeletion(ctx contractapi.TransactionContextInterface, id string, reserve bool) (*Proposal, error) {
+	if err := s.authorizeWrite(ctx); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.readDevice(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.propose(ctx, &Proposal{Action: ActionDelete, DeviceID: id, Reserve: reserve})
+}
+
+// ProposeReactivation proposes to move a revoked device back to active
+func (s *SmartContract) ProposeReactivation(ctx contractapi.TransactionContextInterface, id string) (*Proposal, error) {
+	if err := s.authorizeWrite(ctx); err != nil {
+		return nil, err
+	}
+
+	asset, err := s.readDevice(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if status := storedStatus(asset.Status); status != StatusRevoked {
+		return nil, fmt.Errorf("only revoked devices need reactivation, the device %s is %s", id, status)
+	}
+	return s.propose(ctx, &Proposal{Action: ActionReactivate, DeviceID: id})
+}
+
+// ApproveProposal adds the approval of the invoking client to a pending
+// proposal and carries out the change once the threshold is met
+func (s *SmartContract) ApproveProposal(ctx contractapi.TransactionContextInterface, proposalID string) (*Proposal, error) {
+	if err := s.authorizeWrite(ctx); err != nil {
+		return nil, err
+	}
+
+	proposal, err := readProposal(ctx, proposalID)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := proposal.checkPending(now); err != nil {
+		return nil, err
+	}
+	approver, err := invokerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if contains(proposal.Approvals, approver) {
+		return nil, fmt.Errorf("%s has already approved proposal %s", approver, proposalID)
+	}
+	proposal.Approvals = append(proposal.Approvals, approver)
+
+	if err := s.advance(ctx, proposal, approver, now); err != nil {
+		return nil, err
+	}
+	return proposal, nil
+}
+
+// GetProposal returns a change proposal
+func (s *SmartContract) GetProposal(ctx contractapi.TransactionContextInterface, proposalID string) (*Proposal, error) {
+	if err := s.authorizeRead(ctx); err != nil {
+		return nil, err
+	}
+
+	proposal, err := readProposal(ctx, proposalID)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	proposal.expire(now)
+	return proposal, nil
+}
+
+// GetPendingProposals returns the proposals still waiting for approvals
+func (s *SmartContract) GetPendingProposals(ctx contractapi.TransactionContextInterface) ([]*Proposal, error) {
+	if err := s.authorizeRead(ctx); err != nil {
+		return nil, err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return pendingProposals(ctx, now)
+}
+
+// propose completes and stores a new proposal, approved by its proposer
+func (s *SmartContract) propose(ctx contractapi.TransactionContextInterface, proposal *Proposal) (*Proposal, error) {
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := pendingProposals(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	for _, other := range pending {
+		if other.DeviceID == proposal.DeviceID {
+			return nil, fmt.Errorf("the device %s already has pending proposal %s to %s it", proposal.DeviceID, other.ID, other.Action)
+		}
+	}
+	proposedBy, err := invokerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	config, err := readConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	proposal.ID = ctx.GetStub().GetTxID()
+	proposal.Threshold = config.approvalThreshold()
+	proposal.Approvals = []string{proposedBy}
+	proposal.State = ProposalPending
+	proposal.ProposedBy = proposedBy
+	proposal.ProposedAt = now.Format(time.RFC3339)
+	proposal.ExpiresAt = now.Add(config.proposalLifetime()).Format(time.RFC3339)
+
+	if err := s.advance(ctx, proposal, proposedBy, now); err != nil {
+		return nil, err
+	}
+	return proposal, nil
+}
+
+// advance carries out the change if the proposal has enough approvals and
+// stores the proposal
+func (s *SmartContract) advance(ctx contractapi.TransactionContextInterface, proposal *Proposal, approver string, now time.Time) error {
+	if len(proposal.Approvals) < proposal.Threshold {
+		if err := putProposal(ctx, proposal); err != nil {
+			return err
+		}
+		event := EventChangeApproved
+		if len(proposal.Approvals) == 1 {
+			event = EventChangeProposed
+		}
+		return emitEvent(ctx, &DeviceEvent{Event: event, DeviceID: proposal.DeviceID, ProposalID: proposal.ID})
+	}
+
+	proposal.State = ProposalExecuted
+	proposal.ExecutedAt = now.Format(time.RFC3339)
+	if err := putProposal(ctx, proposal); err != nil {
+		return err
+	}
+
+	asset, err := s.readDevice(ctx, proposal.DeviceID)
+	if err != nil {
+		return err
+	}
+	oldStatus := storedStatus(asset.Status)
+	switch proposal.Action {
+	case ActionDelete:
+		if err := s.deleteDevice(ctx, asset, proposal.Reserve, approver); err != nil {
+			return err
+		}
+		return emitEvent(ctx, &DeviceEvent{Event: EventDeviceDeleted, DeviceID: asset.ID, OldStatus: oldStatus, ProposalID: proposal.ID})
+	case ActionReactivate:
+		if oldStatus != StatusRevoked {
+			return fmt.Errorf("the device %s is no longer revoked", asset.ID)
+		}
+		asset.setStatus(StatusActive)
+		asset.UpdatedBy = approver
+		if err := s.putDeviceStatus(ctx, asset, oldStatus); err != nil {
+			return err
+		}
+		return emitEvent(ctx, &DeviceEvent{Event: EventDeviceUpdated, DeviceID: asset.ID, OldStatus: oldStatus, NewStatus: StatusActive, ProposalID: proposal.ID})
+	default:
+		return fmt.Errorf("unknown proposal action %q", proposal.Action)
+	}
+}
+
+// checkUnapproved returns an error if moving a device from one status to
+// another needs an approved proposal
+func checkUnapproved(id string, from string, to string) error {
+	if from == StatusRevoked && to == StatusActive {
+		return fmt.Errorf("the revoked device %s can only be reactivated through ProposeReactivation", id)
+	}
+	return nil
+}
+
+// checkPending returns an error unless the proposal still takes approvals at now
+func (proposal *Proposal) checkPending(now time.Time) error {
+	proposal.expire(now)
+	switch proposal.State {
+	case ProposalPending:
+		return nil
+	case ProposalExpired:
+		return fmt.Errorf("the proposal %s expired at %s", proposal.ID, proposal.ExpiresAt)
+	default:
+		return fmt.Errorf("the proposal %s was already executed at %s", proposal.ID, proposal.ExecutedAt)
+	}
+}
+
+// expire marks a pending proposal past its deadline as expired
+func (proposal *Proposal) expire(now time.Time) {
+	if proposal.State != ProposalPending {
+		return
+	}
+	expiresAt, err := time.Parse(time.RFC3339, proposal.ExpiresAt)
+	if err != nil || !now.Before(expiresAt) {
+		proposal.State = ProposalExpired
+	}
+}
+
+// pendingProposals returns the proposals that are neither executed nor expired at now
+func pendingProposals(ctx contractapi.TransactionContextInterface, now time.Time) ([]*Proposal, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(proposalIndex, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read proposals: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	proposals := []*Proposal{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var proposal Proposal
+		if err := json.Unmarshal(queryResponse.Value, &proposal); err != nil {
+			return nil, err
+		}
+		proposal.expire(now)
+		if proposal.State == ProposalPending {
+			proposals = append(proposals, &proposal)
+		}
+	}
+	return proposals, nil
+}
+
+func readProposal(ctx contractapi.TransactionContextInterface, proposalID string) (*Proposal, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(proposalIndex, []string{proposalID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create proposal key: %v", err)
+	}
+	proposalJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read proposal: %v", err)
+	}
+	if proposalJSON == nil {
+		return nil, fmt.Errorf("the proposal %s does not exist", proposalID)
+	}
+
+	var proposal Proposal
+	if err := json.Unmarshal(proposalJSON, &proposal); err != nil {
+		return nil, err
+	}
+	return &proposal, nil
+}
+
+func putProposal(ctx contractapi.TransactionContextInterface, proposal *Proposal) error {
+	proposalJSON, err := json.Marshal(proposal)
+	if err != nil {
+		return err
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(proposalIndex, []string{proposal.ID})
+	if err != nil {
+		return fmt.Errorf("failed to create proposal key: %v", err)
+	}
+	if err := ctx.GetStub().PutState(key, proposalJSON); err != nil {
+		return fmt.Errorf("failed to put proposal: %v", err)
+	}
+	return nil
+}
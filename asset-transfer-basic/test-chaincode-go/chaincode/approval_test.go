@@ -0,0 +1,228 @@
+package chaincode_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func (l *ledger) propose(fn func(ctx contractapi.TransactionContextInterface) (*chaincode.Proposal, error)) (*chaincode.Proposal, error) {
+	var proposal *chaincode.Proposal
+	err := l.submit(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		proposal, err = fn(ctx)
+		return err
+	})
+	return proposal, err
+}
+
+func (l *ledger) approve(proposalID string) (*chaincode.Proposal, error) {
+	return l.propose(func(ctx contractapi.TransactionContextInterface) (*chaincode.Proposal, error) {
+		return l.contract.ApproveProposal(ctx, proposalID)
+	})
+}
+
+func (l *ledger) proposal(proposalID string) (*chaincode.Proposal, error) {
+	var proposal *chaincode.Proposal
+	err := l.evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		proposal, err = l.contract.GetProposal(ctx, proposalID)
+		return err
+	})
+	return proposal, err
+}
+
+func (l *ledger) pendingProposals() []*chaincode.Proposal {
+	l.t.Helper()
+	var proposals []*chaincode.Proposal
+	require.NoError(l.t, l.evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		proposals, err = l.contract.GetPendingProposals(ctx)
+		return err
+	}))
+	return proposals
+}
+
+func TestProposeDeletion(t *testing.T) {
+	l := newLedger(t)
+	l.register("D1")
+
+	proposal, err := l.propose(func(ctx contractapi.TransactionContextInterface) (*chaincode.Proposal, error) {
+		return l.contract.ProposeDeletion(ctx, "D1", true)
+	})
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.Proposal{
+		ID:         "tx2",
+		Action:     chaincode.ActionDelete,
+		DeviceID:   "D1",
+		Reserve:    true,
+		Threshold:  chaincode.DefaultApprovalThreshold,
+		Approvals:  []string{"Org1MSP/x509::CN=admin::CN=ca.org1.example.com"},
+		State:      chaincode.ProposalPending,
+		ProposedBy: "Org1MSP/x509::CN=admin::CN=ca.org1.example.com",
+		ProposedAt: "2024-01-01T00:00:02Z",
+		ExpiresAt:  "2024-01-04T00:00:02Z",
+	}, proposal)
+	event := l.lastEvent()
+	require.Equal(t, chaincode.EventChangeProposed, event.Event)
+	require.Equal(t, "tx2", event.ProposalID)
+	require.Empty(t, l.asset("D1").DeletedAt)
+	require.Equal(t, []*chaincode.Proposal{proposal}, l.pendingProposals())
+
+	_, err = l.propose(func(ctx contractapi.TransactionContextInterface) (*chaincode.Proposal, error) {
+		return l.contract.ProposeDeletion(ctx, "D1", false)
+	})
+	require.EqualError(t, err, "the device D1 already has pending proposal tx2 to delete it")
+
+	// the proposer cannot approve twice
+	_, err = l.approve("tx2")
+	require.EqualError(t, err, "Org1MSP/x509::CN=admin::CN=ca.org1.example.com has already approved proposal tx2")
+
+	proposal, err = l.as(org1Approver).approve("tx2")
+	require.NoError(t, err)
+	require.Equal(t, chaincode.ProposalExecuted, proposal.State)
+	require.Equal(t, "2024-01-01T00:00:05Z", proposal.ExecutedAt)
+	require.Len(t, proposal.Approvals, 2)
+
+	asset := l.asset("D1")
+	require.Equal(t, "2024-01-01T00:00:05Z", asset.DeletedAt)
+	require.True(t, asset.Reserved)
+	require.Equal(t, "Org1MSP/x509::CN=admin2::CN=ca.org1.example.com", asset.UpdatedBy)
+	event = l.lastEvent()
+	require.Equal(t, chaincode.EventDeviceDeleted, event.Event)
+	require.Equal(t, "tx2", event.ProposalID)
+	require.Empty(t, l.pendingProposals())
+
+	_, err = l.as(org2Admin).approve("tx2")
+	require.EqualError(t, err, "the proposal tx2 was already executed at 2024-01-01T00:00:05Z")
+	_, err = l.approve("tx9")
+	require.EqualError(t, err, "the proposal tx9 does not exist")
+	_, err = l.propose(func(ctx contractapi.TransactionContextInterface) (*chaincode.Proposal, error) {
+		return l.contract.ProposeDeletion(ctx, "D2", false)
+	})
+	require.EqualError(t, err, "the device D2 does not exist")
+}
+
+func TestApprovalThreshold(t *testing.T) {
+	l := newLedger(t)
+	l.configure(chaincode.Config{ApprovalThreshold: 3})
+	l.register("D1")
+
+	proposal, err := l.propose(func(ctx contractapi.TransactionContextInterface) (*chaincode.Proposal, error) {
+		return l.contract.ProposeDeletion(ctx, "D1", false)
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, proposal.Threshold)
+
+	proposal, err = l.as(org1Approver).approve(proposal.ID)
+	require.NoError(t, err)
+	require.Equal(t, chaincode.ProposalPending, proposal.State)
+	require.Equal(t, chaincode.EventChangeApproved, l.lastEvent().Event)
+	require.Empty(t, l.asset("D1").DeletedAt)
+
+	proposal, err = l.as(org2Admin).approve(proposal.ID)
+	require.NoError(t, err)
+	require.Equal(t, chaincode.ProposalExecuted, proposal.State)
+	require.NotEmpty(t, l.asset("D1").DeletedAt)
+
+	// a single approval carries out the change at once
+	l.configure(chaincode.Config{ApprovalThreshold: 1})
+	l.register("D2")
+	proposal, err = l.propose(func(ctx contractapi.TransactionContextInterface) (*chaincode.Proposal, error) {
+		return l.contract.ProposeDeletion(ctx, "D2", false)
+	})
+	require.NoError(t, err)
+	require.Equal(t, chaincode.ProposalExecuted, proposal.State)
+	require.NotEmpty(t, l.asset("D2").DeletedAt)
+}
+
+func TestProposalExpiry(t *testing.T) {
+	l := newLedger(t)
+	l.configure(chaincode.Config{ProposalLifetime: "1h"})
+	l.register("D1")
+
+	proposal, err := l.propose(func(ctx contractapi.TransactionContextInterface) (*chaincode.Proposal, error) {
+		return l.contract.ProposeDeletion(ctx, "D1", false)
+	})
+	require.NoError(t, err)
+	require.Equal(t, "2024-01-01T01:00:02Z", proposal.ExpiresAt)
+
+	l.stub.Timestamp = time.Date(2024, 1, 1, 1, 0, 1, 0, time.UTC)
+	_, err = l.as(org1Approver).approve(proposal.ID)
+	require.EqualError(t, err, "the proposal tx2 expired at 2024-01-01T01:00:02Z")
+	require.Empty(t, l.asset("D1").DeletedAt)
+
+	proposal, err = l.proposal("tx2")
+	require.NoError(t, err)
+	require.Equal(t, chaincode.ProposalExpired, proposal.State)
+	require.Empty(t, l.pendingProposals())
+
+	// an expired proposal no longer blocks a new one
+	_, err = l.as(org1Admin).propose(func(ctx contractapi.TransactionContextInterface) (*chaincode.Proposal, error) {
+		return l.contract.ProposeDeletion(ctx, "D1", false)
+	})
+	require.NoError(t, err)
+}
+
+func TestProposeReactivation(t *testing.T) {
+	l := newLedger(t)
+	l.register("D1")
+
+	_, err := l.propose(func(ctx contractapi.TransactionContextInterface) (*chaincode.Proposal, error) {
+		return l.contract.ProposeReactivation(ctx, "D1")
+	})
+	require.EqualError(t, err, "only revoked devices need reactivation, the device D1 is active")
+
+	l.update("D1", chaincode.StatusRevoked)
+	err = l.submit(func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.Update(ctx, "D1", chaincode.StatusActive, "")
+	})
+	require.EqualError(t, err, "the revoked device D1 can only be reactivated through ProposeReactivation")
+
+	// revoked devices may still be decommissioned directly
+	l.register("D2")
+	l.update("D2", chaincode.StatusRevoked)
+	l.update("D2", chaincode.StatusDecommissioned)
+
+	proposal, err := l.propose(func(ctx contractapi.TransactionContextInterface) (*chaincode.Proposal, error) {
+		return l.contract.ProposeReactivation(ctx, "D1")
+	})
+	require.NoError(t, err)
+	require.Equal(t, chaincode.ActionReactivate, proposal.Action)
+	_, err = l.auth("D1")
+	require.Error(t, err)
+
+	proposal, err = l.as(org2Admin).approve(proposal.ID)
+	require.NoError(t, err)
+	require.Equal(t, chaincode.ProposalExecuted, proposal.State)
+	asset := l.asset("D1")
+	require.Equal(t, chaincode.StatusActive, asset.Status)
+	require.Equal(t, "Org2MSP/x509::CN=admin::CN=ca.org2.example.com", asset.UpdatedBy)
+	event := l.lastEvent()
+	require.Equal(t, chaincode.EventDeviceUpdated, event.Event)
+	require.Equal(t, chaincode.StatusRevoked, event.OldStatus)
+	require.Equal(t, chaincode.StatusActive, event.NewStatus)
+	require.Equal(t, proposal.ID, event.ProposalID)
+	_, err = l.auth("D1")
+	require.NoError(t, err)
+	require.Equal(t, []string{"D1"}, l.listByStatus(chaincode.StatusActive))
+}
+
+func TestReactivationNoLongerRevoked(t *testing.T) {
+	l := newLedger(t)
+	l.register("D1")
+	l.update("D1", chaincode.StatusRevoked)
+
+	proposal, err := l.propose(func(ctx contractapi.TransactionContextInterface) (*chaincode.Proposal, error) {
+		return l.contract.ProposeReactivation(ctx, "D1")
+	})
+	require.NoError(t, err)
+	l.update("D1", chaincode.StatusDecommissioned)
+
+	_, err = l.as(org1Approver).approve(proposal.ID)
+	require.EqualError(t, err, "the device D1 is no longer revoked")
+	require.Equal(t, chaincode.StatusDecommissioned, l.asset("D1").Status)
+}
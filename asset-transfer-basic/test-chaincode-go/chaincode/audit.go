@@ -0,0 +1,199 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// authAttemptIndex is the composite key object type of the audit records,
+// keyed by device ID, attempt time and transaction ID
+const authAttemptIndex = "authattempt~id~time~txid"
+
+// auditTimeLayout is fixed width so that audit keys sort chronologically
+const auditTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+// maxReasonLength caps the reason stored with an authentication attempt
+const maxReasonLength = 256
+
+// Bounds of the attempt time of a recorded authentication attempt relative
+// to the time of the transaction recording it. Gateways queue their records
+// and retry them while the network is unreachable, so an attempt may be
+// recorded well after it was made, but never before it.
+const (
+	MaxAttemptDelay     = 24 * time.Hour
+	MaxAttemptClockSkew = 5 * time.Minute
+)
+
+// Outcomes of an authentication attempt
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// AuthAttempt is the audit record of one device authentication attempt.
+// AttemptedAt is when the gateway saw the attempt and Timestamp when the
+// record was committed.
+type AuthAttempt struct {
+	DeviceID    string `json:"DeviceID"`
+	Gateway     string `json:"Gateway"`
+	Outcome     string `json:"Outcome"`
+	Reason      string `json:"Reason,omitempty" metadata:",optional"`
+	AttemptedAt string `json:"AttemptedAt"`
+	Timestamp   string `json:"Timestamp"`
+	TxID        string `json:"TxID"`
+}
+
+// RecordAuthAttempt adds an audit record for an authentication attempt made
+// through the invoking gateway and updates the failure counter of the
+// device, locking it out after too many consecutive failures. attemptedAt is
+// the RFC 3339 time the gateway saw the attempt; it must lie at most
+// MaxAttemptDelay before and MaxAttemptClockSkew after the transaction time.
+// Attempts for unknown devices are recorded too. Only clients under the
+// gateway policy, which may call Auth, record attempts, and only those of
+// the organization owning the device, so that neither readers nor other
+// organizations can lock devices out with made-up failures.
+func (s *SmartContract) RecordAuthAttempt(ctx contractapi.TransactionContextInterface, id string, outcome string, reason string, attemptedAt string) error {
+	if err := s.authorizeGateway(ctx); err != nil {
+		return err
+	}
+
+	if id == "" {
+		return fmt.Errorf("the device ID must not be empty")
+	}
+	if outcome != OutcomeSuccess && outcome != OutcomeFailure {
+		return fmt.Errorf("invalid outcome %q, expected %s or %s", outcome, OutcomeSuccess, OutcomeFailure)
+	}
+	if len(reason) > maxReasonLength {
+		reason = reason[:maxReasonLength]
+	}
+	asset, err := readRecord(ctx, id)
+	if err != nil {
+		return err
+	}
+	known := asset != nil && !asset.deleted()
+	if known {
+		if err := checkOwner(ctx, asset); err != nil {
+			return err
+		}
+	}
+
+	gateway, err := invokerID(ctx)
+	if err != nil {
+		return err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	attemptTime, err := time.Parse(time.RFC3339Nano, attemptedAt)
+	if err != nil {
+		return fmt.Errorf("invalid attempt time %q, expected RFC 3339: %v", attemptedAt, err)
+	}
+	if attemptTime.Before(now.Add(-MaxAttemptDelay)) || attemptTime.After(now.Add(MaxAttemptClockSkew)) {
+		return fmt.Errorf("the attempt time %s is too far from the transaction time %s", attemptedAt, now.Format(time.RFC3339))
+	}
+	attemptTime = attemptTime.UTC()
+	txID := ctx.GetStub().GetTxID()
+
+	attempt := AuthAttempt{
+		DeviceID:    id,
+		Gateway:     gateway,
+		Outcome:     outcome,
+		Reason:      reason,
+		AttemptedAt: attemptTime.Format(time.RFC3339Nano),
+		Timestamp:   now.Format(time.RFC3339Nano),
+		TxID:        txID,
+	}
+	attemptJSON, err := json.Marshal(attempt)
+	if err != nil {
+		return err
+	}
+
+	attemptKey, err := ctx.GetStub().CreateCompositeKey(authAttemptIndex, []string{id, attemptTime.Format(auditTimeLayout), txID})
+	if err != nil {
+		return fmt.Errorf("failed to create audit key: %v", err)
+	}
+	if err := ctx.GetStub().PutState(attemptKey, attemptJSON); err != nil {
+		return fmt.Errorf("failed to put audit record: %v", err)
+	}
+
+	if !known {
+		return nil
+	}
+	locked, err := s.countAttempt(ctx, id, outcome, now)
+	if err != nil {
+		return err
+	}
+	if locked {
+		return emitDeviceEvent(ctx, EventDeviceLockedOut, id, "", "")
+	}
+	return nil
+}
+
+// GetAuthAttempts returns the authentication attempts of a device made
+// between from and to, oldest first. Both bounds are RFC 3339 timestamps and
+// inclusive; an empty bound leaves that side open.
+func (s *SmartContract) GetAuthAttempts(ctx contractapi.TransactionContextInterface, id string, from string, to string) ([]*AuthAttempt, error) {
+	if err := s.authorizeRead(ctx); err != nil {
+		return nil, err
+	}
+
+	fromTime, err := parseBound(from, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	toTime, err := parseBound(to, time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC))
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(authAttemptIndex, []string{id})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var attempts []*AuthAttempt
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, err
+		}
+		attemptedAt, err := time.Parse(auditTimeLayout, attributes[1])
+		if err != nil {
+			return nil, err
+		}
+		if attemptedAt.Before(fromTime) || attemptedAt.After(toTime) {
+			continue
+		}
+
+		var attempt AuthAttempt
+		err = json.Unmarshal(queryResponse.Value, &attempt)
+		if err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, &attempt)
+	}
+
+	return attempts, nil
+}
+
+// parseBound parses an optional RFC 3339 time range bound
+func parseBound(bound string, fallback time.Time) (time.Time, error) {
+	if bound == "" {
+		return fallback, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, bound)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected RFC 3339: %v", bound, err)
+	}
+	return parsed, nil
+}
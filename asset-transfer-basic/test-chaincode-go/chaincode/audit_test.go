@@ -0,0 +1,147 @@
+package chaincode_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+// recordAttempt records an authentication attempt made at the time of the
+// recording transaction as the gateway of Org1 and then switches back to the
+// current identity
+func (l *ledger) recordAttempt(id string, outcome string, reason string) {
+	l.t.Helper()
+	defer l.ctx.GetClientIdentityReturns(l.ctx.GetClientIdentity())
+	require.NoError(l.t, l.as(org1Gateway).submit(func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.RecordAuthAttempt(ctx, id, outcome, reason, l.now())
+	}))
+}
+
+// now returns the time of the running transaction
+func (l *ledger) now() string {
+	return l.stub.Timestamp.Format(time.RFC3339)
+}
+
+func (l *ledger) authAttempts(id string, from string, to string) ([]*chaincode.AuthAttempt, error) {
+	var attempts []*chaincode.AuthAttempt
+	err := l.evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		attempts, err = l.contract.GetAuthAttempts(ctx, id, from, to)
+		return err
+	})
+	return attempts, err
+}
+
+func TestRecordAuthAttempt(t *testing.T) {
+	l := newLedger(t)
+	l.register("D1")
+
+	l.recordAttempt("D1", chaincode.OutcomeSuccess, "")
+	l.recordAttempt("D1", chaincode.OutcomeFailure, strings.Repeat("x", 300))
+	l.recordAttempt("D9", chaincode.OutcomeFailure, "unknown device")
+
+	attempts, err := l.authAttempts("D1", "", "")
+	require.NoError(t, err)
+	require.Len(t, attempts, 2)
+	require.Equal(t, chaincode.OutcomeSuccess, attempts[0].Outcome)
+	require.Equal(t, "Org1MSP/x509::CN=gateway1::CN=ca.org1.example.com", attempts[0].Gateway)
+	require.Equal(t, "tx2", attempts[0].TxID)
+	require.Equal(t, "2024-01-01T00:00:02Z", attempts[0].AttemptedAt)
+	require.Equal(t, chaincode.OutcomeFailure, attempts[1].Outcome)
+	require.Len(t, attempts[1].Reason, 256)
+
+	// attempts on unknown devices are kept for auditing
+	attempts, err = l.authAttempts("D9", "", "")
+	require.NoError(t, err)
+	require.Len(t, attempts, 1)
+
+	err = l.as(org1Gateway).submit(func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.RecordAuthAttempt(ctx, "D1", "maybe", "", l.now())
+	})
+	require.EqualError(t, err, `invalid outcome "maybe", expected success or failure`)
+	err = l.submit(func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.RecordAuthAttempt(ctx, "", chaincode.OutcomeSuccess, "", l.now())
+	})
+	require.EqualError(t, err, "the device ID must not be empty")
+}
+
+func TestRecordAuthAttemptAccess(t *testing.T) {
+	l := newLedger(t)
+	l.configure(chaincode.Config{LockoutThreshold: 1})
+	l.register("D1")
+
+	// readers cannot lock devices out with made-up failures
+	record := func(identity *mocks.ClientIdentity) error {
+		return l.as(identity).submit(func(ctx contractapi.TransactionContextInterface) error {
+			return l.contract.RecordAuthAttempt(ctx, "D1", chaincode.OutcomeFailure, "", l.now())
+		})
+	}
+	require.EqualError(t, record(org1User), "access denied: the attribute role=device-gateway is required to authenticate devices")
+	require.EqualError(t, record(org1Admin), "access denied: the attribute role=device-gateway is required to authenticate devices")
+	require.EqualError(t, record(org3Admin), "access denied: clients of Org3MSP are not allowed to authenticate devices")
+	attempts, err := l.as(org1User).authAttempts("D1", "", "")
+	require.NoError(t, err)
+	require.Empty(t, attempts)
+	require.Equal(t, &chaincode.Lockout{DeviceID: "D1"}, l.lockout("D1"))
+	_, err = l.auth("D1")
+	require.NoError(t, err)
+
+	// nor can the gateways of another organization
+	require.EqualError(t, record(org2Gateway), "access denied: the device D1 is owned by Org1MSP")
+	require.Equal(t, &chaincode.Lockout{DeviceID: "D1"}, l.lockout("D1"))
+
+	require.NoError(t, record(org1Gateway))
+	_, err = l.auth("D1")
+	require.Error(t, err)
+}
+
+func TestGetAuthAttempts(t *testing.T) {
+	l := newLedger(t)
+	l.register("D1")
+	for i := 0; i < 3; i++ {
+		l.recordAttempt("D1", chaincode.OutcomeSuccess, "")
+	}
+
+	attempts, err := l.authAttempts("D1", "2024-01-01T00:00:03Z", "2024-01-01T00:00:03Z")
+	require.NoError(t, err)
+	require.Len(t, attempts, 1)
+	require.Equal(t, "2024-01-01T00:00:03Z", attempts[0].Timestamp)
+
+	attempts, err = l.authAttempts("D1", "2024-01-01T00:00:03Z", "")
+	require.NoError(t, err)
+	require.Len(t, attempts, 2)
+
+	_, err = l.authAttempts("D1", "yesterday", "")
+	require.Error(t, err)
+}
+
+func TestRecordAuthAttemptTime(t *testing.T) {
+	l := newLedger(t)
+	l.register("D1")
+
+	record := func(attemptedAt string) error {
+		return l.as(org1Gateway).submit(func(ctx contractapi.TransactionContextInterface) error {
+			return l.contract.RecordAuthAttempt(ctx, "D1", chaincode.OutcomeSuccess, "", attemptedAt)
+		})
+	}
+	// an attempt queued while the network was unreachable keeps its time
+	l.stub.Timestamp = l.stub.Timestamp.Add(time.Hour)
+	require.NoError(t, record("2024-01-01T00:00:30Z"))
+	attempts, err := l.authAttempts("D1", "", "2024-01-01T00:01:00Z")
+	require.NoError(t, err)
+	require.Len(t, attempts, 1)
+	require.Equal(t, "2024-01-01T00:00:30Z", attempts[0].AttemptedAt)
+	require.Equal(t, "2024-01-01T01:00:02Z", attempts[0].Timestamp)
+
+	require.EqualError(t, record("2023-12-31T00:00:00Z"), "the attempt time 2023-12-31T00:00:00Z is too far from the transaction time 2024-01-01T01:00:03Z")
+	require.EqualError(t, record("2024-01-01T02:00:00Z"), "the attempt time 2024-01-01T02:00:00Z is too far from the transaction time 2024-01-01T01:00:04Z")
+	require.Error(t, record("yesterday"))
+	attempts, err = l.authAttempts("D1", "", "")
+	require.NoError(t, err)
+	require.Len(t, attempts, 1)
+}
@@ -0,0 +1,180 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// transientKeysField is the transient map entry that carries the keys of the
+// AES devices of a batch as a JSON object from device ID to key
+const transientKeysField = "keys"
+
+// maxBatchSize bounds the number of devices registered in one transaction
+const maxBatchSize = 1000
+
+// DeviceRegistration describes one device to register
+type DeviceRegistration struct {
+	DeviceMetadata
+	DeviceValidity
+	ID        string `json:"ID"`
+	Status    string `json:"Status"`
+	KeyType   string `json:"KeyType,omitempty" metadata:",optional"`
+	PublicKey string `json:"PublicKey,omitempty" metadata:",optional"`
+}
+
+// BatchIssue explains why one entry of a batch cannot be registered
+type BatchIssue struct {
+	Index int    `json:"Index"`
+	ID    string `json:"ID"`
+	Error string `json:"Error"`
+}
+
+// CheckBatch reports every entry of a JSON array of registrations that
+// RegisterBatch would reject, without writing anything
+func (s *SmartContract) CheckBatch(ctx contractapi.TransactionContextInterface, devicesJSON string) ([]*BatchIssue, error) {
+	if err := s.authorizeWrite(ctx); err != nil {
+		return nil, err
+	}
+
+	_, _, issues, err := s.checkBatch(ctx, devicesJSON)
+	return issues, err
+}
+
+// RegisterBatch registers every device of a JSON array of registrations in
+// one transaction. Keys of AES devices are read from the transient map. If
+// any entry is invalid, duplicated within the batch or already registered,
+// the whole batch is rejected and nothing is written.
+func (s *SmartContract) RegisterBatch(ctx contractapi.TransactionContextInterface, devicesJSON string) (int, error) {
+	if err := s.authorizeWrite(ctx); err != nil {
+		return 0, err
+	}
+
+	registrations, keys, issues, err := s.checkBatch(ctx, devicesJSON)
+	if err != nil {
+		return 0, err
+	}
+	if len(issues) > 0 {
+		var problems []string
+		for _, issue := range issues {
+			problems = append(problems, fmt.Sprintf("#%d %s: %s", issue.Index, issue.ID, issue.Error))
+		}
+		return 0, fmt.Errorf("batch rejected: %s", strings.Join(problems, "; "))
+	}
+
+	updatedBy, err := invokerID(ctx)
+	if err != nil {
+		return 0, err
+	}
+	ownerMSP, err := invokerMSP(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for _, registration := range registrations {
+		if err := s.registerDevice(ctx, registration, keys[registration.ID], ownerMSP, updatedBy); err != nil {
+			return 0, err
+		}
+		ids = append(ids, registration.ID)
+	}
+
+	if err := emitEvent(ctx, &DeviceEvent{Event: EventDevicesImported, DeviceIDs: ids}); err != nil {
+		return 0, err
+	}
+	return len(registrations), nil
+}
+
+// checkBatch parses and validates a batch, returning the normalized
+// registrations, the AES keys from the transient map and the issues found
+func (s *SmartContract) checkBatch(ctx contractapi.TransactionContextInterface, devicesJSON string) ([]*DeviceRegistration, map[string]string, []*BatchIssue, error) {
+	var registrations []*DeviceRegistration
+	if err := json.Unmarshal([]byte(devicesJSON), &registrations); err != nil {
+		return nil, nil, nil, fmt.Errorf("devices must be a JSON array of registrations: %v", err)
+	}
+	if len(registrations) == 0 {
+		return nil, nil, nil, fmt.Errorf("the batch is empty")
+	}
+	if len(registrations) > maxBatchSize {
+		return nil, nil, nil, fmt.Errorf("the batch holds %d devices, at most %d are allowed", len(registrations), maxBatchSize)
+	}
+
+	keys := map[string]string{}
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read transient map: %v", err)
+	}
+	if keysJSON, ok := transientMap[transientKeysField]; ok {
+		if err := json.Unmarshal(keysJSON, &keys); err != nil {
+			return nil, nil, nil, fmt.Errorf("the %q transient entry must be a JSON object of device keys: %v", transientKeysField, err)
+		}
+	}
+
+	var issues []*BatchIssue
+	seen := map[string]bool{}
+	for i, registration := range registrations {
+		var problem error
+		if registration == nil {
+			registration = &DeviceRegistration{}
+			registrations[i] = registration
+		}
+		if err := registration.normalize(); err != nil {
+			problem = err
+		} else if seen[registration.ID] {
+			problem = fmt.Errorf("duplicate device in batch")
+		} else if err := s.checkRegistrable(ctx, registration.ID); err != nil {
+			problem = err
+		} else if registration.KeyType == KeyTypeAES {
+			if key, ok := keys[registration.ID]; !ok {
+				problem = fmt.Errorf("no key passed in the transient map")
+			} else {
+				problem = validateAESKey(key)
+			}
+		}
+		seen[registration.ID] = true
+
+		if problem != nil {
+			issues = append(issues, &BatchIssue{Index: i, ID: registration.ID, Error: problem.Error()})
+		}
+	}
+
+	return registrations, keys, issues, nil
+}
+
+// normalize validates a registration in place, normalizing its status and key type
+func (registration *DeviceRegistration) normalize() error {
+	if registration.ID == "" {
+		return fmt.Errorf("the device ID must not be empty")
+	}
+
+	status, err := parseStatus(registration.Status)
+	if err != nil {
+		return err
+	}
+	if !contains(initialStatuses, status) {
+		return fmt.Errorf("a device must be registered as %s, not %s", strings.Join(initialStatuses, " or "), status)
+	}
+	registration.Status = status
+
+	keyType, err := parseKeyType(registration.KeyType)
+	if err != nil {
+		return err
+	}
+	registration.KeyType = keyType
+
+	if err := registration.DeviceMetadata.normalize(); err != nil {
+		return err
+	}
+	if err := registration.DeviceValidity.normalize(); err != nil {
+		return err
+	}
+
+	if keyType == KeyTypeAES {
+		if registration.PublicKey != "" {
+			return fmt.Errorf("AES devices do not take a public key")
+		}
+		return nil
+	}
+	return validatePublicKey(keyType, registration.PublicKey)
+}
@@ -0,0 +1,82 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterBatch(t *testing.T) {
+	l := newLedger(t)
+	devicesJSON := `[
+		{"ID": "D1", "Status": "active", "Model": "esp32-s3"},
+		{"ID": "D2", "Status": "pending"}
+	]`
+
+	var count int
+	l.stub.Transient = map[string][]byte{"keys": []byte(`{"D1": "` + rotatedKey + `", "D2": "` + testKey + `"}`)}
+	require.NoError(t, l.submit(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		count, err = l.contract.RegisterBatch(ctx, devicesJSON)
+		return err
+	}))
+	require.Equal(t, 2, count)
+	require.Equal(t, "esp32-s3", l.asset("D1").Model)
+	require.Equal(t, chaincode.StatusPending, l.asset("D2").Status)
+	require.Equal(t, []string{"D1", "D2"}, l.lastEvent().DeviceIDs)
+
+	credential, err := l.auth("D1")
+	require.NoError(t, err)
+	require.Equal(t, rotatedKey, credential.Key)
+}
+
+func TestCheckBatch(t *testing.T) {
+	l := newLedger(t)
+	l.register("D1")
+	devicesJSON := `[
+		{"ID": "D1", "Status": "active"},
+		{"ID": "D2", "Status": "active"},
+		{"ID": "D2", "Status": "active"},
+		{"ID": "D3", "Status": "active"},
+		{"ID": "D4", "Status": "revoked"},
+		{"ID": "", "Status": "active"}
+	]`
+	l.stub.Transient = map[string][]byte{"keys": []byte(`{"D2": "` + testKey + `"}`)}
+
+	var issues []*chaincode.BatchIssue
+	require.NoError(t, l.evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		issues, err = l.contract.CheckBatch(ctx, devicesJSON)
+		return err
+	}))
+	require.Equal(t, []*chaincode.BatchIssue{
+		{Index: 0, ID: "D1", Error: "the device D1 already exists"},
+		{Index: 2, ID: "D2", Error: "duplicate device in batch"},
+		{Index: 3, ID: "D3", Error: "no key passed in the transient map"},
+		{Index: 4, ID: "D4", Error: "a device must be registered as pending or active, not revoked"},
+		{Index: 5, ID: "", Error: "the device ID must not be empty"},
+	}, issues)
+
+	// a single bad entry rejects the whole batch
+	l.stub.Transient = map[string][]byte{"keys": []byte(`{"D2": "` + testKey + `"}`)}
+	err := l.submit(func(ctx contractapi.TransactionContextInterface) error {
+		_, err := l.contract.RegisterBatch(ctx, `[{"ID": "D2", "Status": "active"}, {"ID": "D1", "Status": "active"}]`)
+		return err
+	})
+	require.EqualError(t, err, "batch rejected: #1 D1: the device D1 already exists")
+	require.Nil(t, l.asset("D2"))
+
+	for devicesJSON, message := range map[string]string{
+		`[]`:   "the batch is empty",
+		`{}`:   "devices must be a JSON array of registrations: json: cannot unmarshal object into Go value of type []*chaincode.DeviceRegistration",
+		`null`: "the batch is empty",
+	} {
+		err := l.evaluate(func(ctx contractapi.TransactionContextInterface) error {
+			_, err := l.contract.CheckBatch(ctx, devicesJSON)
+			return err
+		})
+		require.EqualError(t, err, message)
+	}
+}
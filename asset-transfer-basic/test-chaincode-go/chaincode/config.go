@@ -0,0 +1,252 @@
+package chaincode
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// configKey is the composite key object type of the contract configuration
+const configKey = "config"
+
+// Config holds the settings of the contract. It is kept in the world state so
+// that every endorsing peer applies the same settings, and it only changes
+// through SetConfig under the admin policy. Settings left at their zero
+// value use the defaults. Durations are Go durations such as "15m".
+type Config struct {
+	ReadPolicy                *AccessPolicy `json:"ReadPolicy,omitempty" metadata:",optional"`
+	WritePolicy               *AccessPolicy `json:"WritePolicy,omitempty" metadata:",optional"`
+	AdminPolicy               *AccessPolicy `json:"AdminPolicy,omitempty" metadata:",optional"`
+	GatewayPolicy             *AccessPolicy `json:"GatewayPolicy,omitempty" metadata:",optional"`
+	LockoutThreshold          int           `json:"LockoutThreshold,omitempty" metadata:",optional"`
+	LockoutDuration           string        `json:"LockoutDuration,omitempty" metadata:",optional"`
+	RequireTransferAcceptance bool          `json:"RequireTransferAcceptance,omitempty" metadata:",optional"`
+	ApprovalThreshold         int           `json:"ApprovalThreshold,omitempty" metadata:",optional"`
+	ProposalLifetime          string        `json:"ProposalLifetime,omitempty" metadata:",optional"`
+	UpdatedBy                 string        `json:"UpdatedBy"`
+	UpdatedAt                 string        `json:"UpdatedAt"`
+}
+
+// SetConfig replaces the configuration of the contract with configJSON, a
+// JSON object of the Config settings. Settings it leaves out use the defaults.
+func (s *SmartContract) SetConfig(ctx contractapi.TransactionContextInterface, configJSON string) (*Config, error) {
+	if err := s.authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	var config Config
+	decoder := json.NewDecoder(bytes.NewReader([]byte(configJSON)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %v", err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	updatedBy, err := invokerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	config.UpdatedBy = updatedBy
+	config.UpdatedAt = now.Format(time.RFC3339)
+	if err := putConfig(ctx, &config); err != nil {
+		return nil, err
+	}
+
+	if err := emitEvent(ctx, &DeviceEvent{Event: EventConfigChanged}); err != nil {
+		return nil, err
+	}
+	return config.effective(), nil
+}
+
+// GetConfig returns the configuration in force, with the defaults filled in
+func (s *SmartContract) GetConfig(ctx contractapi.TransactionContextInterface) (*Config, error) {
+	if err := s.authorizeRead(ctx); err != nil {
+		return nil, err
+	}
+
+	config, err := readConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return config.effective(), nil
+}
+
+// validate returns an error if a setting is out of range
+func (config *Config) validate() error {
+	if config.LockoutThreshold < 0 {
+		return fmt.Errorf("LockoutThreshold must not be negative, got %d", config.LockoutThreshold)
+	}
+	if config.ApprovalThreshold < 0 {
+		return fmt.Errorf("ApprovalThreshold must not be negative, got %d", config.ApprovalThreshold)
+	}
+	durations := []struct {
+		name  string
+		value string
+	}{
+		{"LockoutDuration", config.LockoutDuration},
+		{"ProposalLifetime", config.ProposalLifetime},
+	}
+	for _, duration := range durations {
+		if duration.value == "" {
+			continue
+		}
+		if parsed, err := time.ParseDuration(duration.value); err != nil || parsed <= 0 {
+			return fmt.Errorf("invalid %s %q, expected a positive duration such as 15m", duration.name, duration.value)
+		}
+	}
+	policies := []struct {
+		name   string
+		policy *AccessPolicy
+	}{
+		{"ReadPolicy", config.ReadPolicy},
+		{"WritePolicy", config.WritePolicy},
+		{"AdminPolicy", config.AdminPolicy},
+		{"GatewayPolicy", config.GatewayPolicy},
+	}
+	for _, policy := range policies {
+		if policy.policy == nil {
+			continue
+		}
+		for name := range policy.policy.Attributes {
+			if name == "" {
+				return fmt.Errorf("the %s requires an attribute without a name", policy.name)
+			}
+		}
+	}
+	return nil
+}
+
+// effective returns a copy of the configuration with the defaults filled in
+func (config *Config) effective() *Config {
+	readPolicy := config.readPolicy()
+	writePolicy := config.writePolicy()
+	adminPolicy := config.adminPolicy()
+	gatewayPolicy := config.gatewayPolicy()
+	return &Config{
+		ReadPolicy:                &readPolicy,
+		WritePolicy:               &writePolicy,
+		AdminPolicy:               &adminPolicy,
+		GatewayPolicy:             &gatewayPolicy,
+		LockoutThreshold:          config.lockoutThreshold(),
+		LockoutDuration:           config.lockoutDuration().String(),
+		RequireTransferAcceptance: config.RequireTransferAcceptance,
+		ApprovalThreshold:         config.approvalThreshold(),
+		ProposalLifetime:          config.proposalLifetime().String(),
+		UpdatedBy:                 config.UpdatedBy,
+		UpdatedAt:                 config.UpdatedAt,
+	}
+}
+
+// readPolicy returns the configured read policy
+func (config *Config) readPolicy() AccessPolicy {
+	return policyOr(config.ReadPolicy, DefaultReadPolicy)
+}
+
+// writePolicy returns the configured write policy
+func (config *Config) writePolicy() AccessPolicy {
+	return policyOr(config.WritePolicy, DefaultWritePolicy)
+}
+
+// adminPolicy returns the configured admin policy
+func (config *Config) adminPolicy() AccessPolicy {
+	return policyOr(config.AdminPolicy, DefaultAdminPolicy)
+}
+
+// gatewayPolicy returns the configured gateway policy
+func (config *Config) gatewayPolicy() AccessPolicy {
+	return policyOr(config.GatewayPolicy, DefaultGatewayPolicy)
+}
+
+// policyOr returns a copy of policy, or of fallback when policy is not set.
+// MSPIDs is never nil so that the policy serializes as the metadata expects.
+func policyOr(policy *AccessPolicy, fallback AccessPolicy) AccessPolicy {
+	result := fallback
+	if policy != nil {
+		result = *policy
+	}
+	if result.MSPIDs == nil {
+		result.MSPIDs = []string{}
+	}
+	return result
+}
+
+// lockoutThreshold returns the configured number of failures that locks a device
+func (config *Config) lockoutThreshold() int {
+	if config.LockoutThreshold > 0 {
+		return config.LockoutThreshold
+	}
+	return DefaultLockoutThreshold
+}
+
+// lockoutDuration returns how long a device stays locked
+func (config *Config) lockoutDuration() time.Duration {
+	return durationOr(config.LockoutDuration, DefaultLockoutDuration)
+}
+
+// approvalThreshold returns the configured number of approvals a proposal needs
+func (config *Config) approvalThreshold() int {
+	if config.ApprovalThreshold > 0 {
+		return config.ApprovalThreshold
+	}
+	return DefaultApprovalThreshold
+}
+
+// proposalLifetime returns how long a proposal stays open
+func (config *Config) proposalLifetime() time.Duration {
+	return durationOr(config.ProposalLifetime, DefaultProposalLifetime)
+}
+
+// durationOr parses a duration validated by SetConfig, or returns fallback
+// when it is not set
+func durationOr(value string, fallback time.Duration) time.Duration {
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return fallback
+	}
+	return duration
+}
+
+// readConfig returns the stored configuration, which is empty until
+// SetConfig is first called
+func readConfig(ctx contractapi.TransactionContextInterface) (*Config, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(configKey, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create config key: %v", err)
+	}
+	configJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration: %v", err)
+	}
+
+	var config Config
+	if configJSON == nil {
+		return &config, nil
+	}
+	if err := json.Unmarshal(configJSON, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func putConfig(ctx contractapi.TransactionContextInterface, config *Config) error {
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(configKey, []string{})
+	if err != nil {
+		return fmt.Errorf("failed to create config key: %v", err)
+	}
+	if err := ctx.GetStub().PutState(key, configJSON); err != nil {
+		return fmt.Errorf("failed to put configuration: %v", err)
+	}
+	return nil
+}
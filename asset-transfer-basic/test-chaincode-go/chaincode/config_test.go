@@ -0,0 +1,101 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func (l *ledger) setConfig(configJSON string) (*chaincode.Config, error) {
+	var config *chaincode.Config
+	err := l.submit(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		config, err = l.contract.SetConfig(ctx, configJSON)
+		return err
+	})
+	return config, err
+}
+
+func (l *ledger) config() *chaincode.Config {
+	l.t.Helper()
+	var config *chaincode.Config
+	require.NoError(l.t, l.evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		config, err = l.contract.GetConfig(ctx)
+		return err
+	}))
+	return config
+}
+
+func TestGetConfigDefaults(t *testing.T) {
+	l := newLedger(t)
+	require.Equal(t, &chaincode.Config{
+		ReadPolicy:        &chaincode.DefaultReadPolicy,
+		WritePolicy:       &chaincode.DefaultWritePolicy,
+		AdminPolicy:       &chaincode.DefaultAdminPolicy,
+		GatewayPolicy:     &chaincode.DefaultGatewayPolicy,
+		LockoutThreshold:  chaincode.DefaultLockoutThreshold,
+		LockoutDuration:   "15m0s",
+		ApprovalThreshold: chaincode.DefaultApprovalThreshold,
+		ProposalLifetime:  "72h0m0s",
+	}, l.as(org1User).config())
+}
+
+func TestSetConfig(t *testing.T) {
+	l := newLedger(t)
+	l.register("D1")
+
+	_, err := l.setConfig(`{"ApprovalThreshold": 3}`)
+	require.EqualError(t, err, "access denied: the attribute role=ledger-admin is required to administer devices")
+
+	config, err := l.as(org1LedgerAdmin).setConfig(`{"ApprovalThreshold": 3, "LockoutDuration": "30m", "RequireTransferAcceptance": true}`)
+	require.NoError(t, err)
+	require.Equal(t, 3, config.ApprovalThreshold)
+	require.Equal(t, "30m0s", config.LockoutDuration)
+	require.True(t, config.RequireTransferAcceptance)
+	require.Equal(t, chaincode.DefaultLockoutThreshold, config.LockoutThreshold)
+	require.Equal(t, "Org1MSP/x509::CN=ledgeradmin::CN=ca.org1.example.com", config.UpdatedBy)
+	require.Equal(t, "2024-01-01T00:00:03Z", config.UpdatedAt)
+	require.Equal(t, chaincode.EventConfigChanged, l.lastEvent().Event)
+	require.Equal(t, config, l.config())
+
+	// every peer reads the same settings from the ledger
+	proposal, err := l.as(org1Admin).propose(func(ctx contractapi.TransactionContextInterface) (*chaincode.Proposal, error) {
+		return l.contract.ProposeDeletion(ctx, "D1", false)
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, proposal.Threshold)
+
+	// the settings left out fall back to the defaults
+	config, err = l.as(org1LedgerAdmin).setConfig(`{}`)
+	require.NoError(t, err)
+	require.Equal(t, chaincode.DefaultApprovalThreshold, config.ApprovalThreshold)
+
+	config, err = l.setConfig(`{"WritePolicy": {"MSPIDs": ["Org1MSP"], "Attributes": {"role": "operator"}}}`)
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.AccessPolicy{MSPIDs: []string{"Org1MSP"}, Attributes: map[string]string{"role": "operator"}}, config.WritePolicy)
+	err = l.as(org1Admin).submit(func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.Update(ctx, "D1", chaincode.StatusSuspended, "")
+	})
+	require.EqualError(t, err, "access denied: the attribute role=operator is required to modify devices")
+}
+
+func TestSetConfigErrors(t *testing.T) {
+	l := newLedger(t)
+	l.as(org1LedgerAdmin)
+
+	_, err := l.setConfig(`{"Threshold": 3}`)
+	require.EqualError(t, err, `invalid configuration: json: unknown field "Threshold"`)
+	_, err = l.setConfig(`{"ApprovalThreshold": -1}`)
+	require.EqualError(t, err, "ApprovalThreshold must not be negative, got -1")
+	_, err = l.setConfig(`{"LockoutThreshold": -2}`)
+	require.EqualError(t, err, "LockoutThreshold must not be negative, got -2")
+	_, err = l.setConfig(`{"ProposalLifetime": "3 days"}`)
+	require.EqualError(t, err, `invalid ProposalLifetime "3 days", expected a positive duration such as 15m`)
+	_, err = l.setConfig(`{"LockoutDuration": "-5m"}`)
+	require.EqualError(t, err, `invalid LockoutDuration "-5m", expected a positive duration such as 15m`)
+	_, err = l.setConfig(`{"ReadPolicy": {"Attributes": {"": "x"}}}`)
+	require.EqualError(t, err, "the ReadPolicy requires an attribute without a name")
+}
@@ -0,0 +1,68 @@
+package chaincode
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+)
+
+// Device credential types. AES devices share a secret key with the ledger,
+// ECDSA and Ed25519 devices register a public key and sign challenges.
+const (
+	KeyTypeAES     = "aes"
+	KeyTypeECDSA   = "ecdsa"
+	KeyTypeEd25519 = "ed25519"
+)
+
+var keyTypes = []string{KeyTypeAES, KeyTypeECDSA, KeyTypeEd25519}
+
+// parseKeyType validates a key type supplied by a client. An empty key type
+// selects AES, the only type devices used to have.
+func parseKeyType(keyType string) (string, error) {
+	normalized := strings.ToLower(strings.TrimSpace(keyType))
+	if normalized == "" {
+		return KeyTypeAES, nil
+	}
+	if !contains(keyTypes, normalized) {
+		return "", fmt.Errorf("invalid key type %q, expected one of %s", keyType, strings.Join(keyTypes, ", "))
+	}
+	return normalized, nil
+}
+
+// keyType returns the credential type of a device. Records written before
+// asymmetric credentials existed are AES devices.
+func (asset *Asset) keyType() string {
+	if asset.KeyType == "" {
+		return KeyTypeAES
+	}
+	return asset.KeyType
+}
+
+// validatePublicKey checks that publicKey is a PEM encoded PKIX public key
+// of the given type
+func validatePublicKey(keyType string, publicKey string) error {
+	block, _ := pem.Decode([]byte(publicKey))
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return fmt.Errorf("the public key must be a PEM encoded PUBLIC KEY block")
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse public key: %v", err)
+	}
+
+	switch parsed.(type) {
+	case *ecdsa.PublicKey:
+		if keyType == KeyTypeECDSA {
+			return nil
+		}
+	case ed25519.PublicKey:
+		if keyType == KeyTypeEd25519 {
+			return nil
+		}
+	}
+	return fmt.Errorf("the public key is not an %s key", keyType)
+}
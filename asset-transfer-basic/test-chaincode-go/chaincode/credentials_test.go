@@ -0,0 +1,60 @@
+package chaincode_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func publicKeyPEM(t *testing.T, publicKey interface{}) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func TestRegisterPublicKeyDevices(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ed25519Key, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	tests := []struct {
+		id        string
+		keyType   string
+		publicKey string
+	}{
+		{"E1", chaincode.KeyTypeECDSA, publicKeyPEM(t, &ecdsaKey.PublicKey)},
+		{"E2", "Ed25519", publicKeyPEM(t, ed25519Key)},
+	}
+	l := newLedger(t)
+	for _, test := range tests {
+		require.NoError(t, l.submit(func(ctx contractapi.TransactionContextInterface) error {
+			return l.contract.Register(ctx, test.id, "active", test.keyType, test.publicKey, "", "", "")
+		}))
+
+		credential, err := l.auth(test.id)
+		require.NoError(t, err)
+		require.Equal(t, test.publicKey, credential.PublicKey)
+		require.Empty(t, credential.Key)
+		require.Nil(t, l.deviceKey("Org1MSP", test.id))
+	}
+	require.Equal(t, chaincode.KeyTypeEd25519, l.asset("E2").KeyType)
+
+	err = l.submit(func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.Register(ctx, "E3", "active", chaincode.KeyTypeEd25519, tests[0].publicKey, "", "", "")
+	})
+	require.EqualError(t, err, "the public key is not an ed25519 key")
+	err = l.submit(func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.Register(ctx, "E3", "active", chaincode.KeyTypeECDSA, "", "", "", "")
+	})
+	require.EqualError(t, err, "the public key must be a PEM encoded PUBLIC KEY block")
+}
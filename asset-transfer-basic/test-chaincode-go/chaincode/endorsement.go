@@ -0,0 +1,90 @@
+package chaincode
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/statebased"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// DeviceEndorsement lists the organizations whose peers must all endorse
+// changes to a device. An empty list means the chaincode endorsement policy
+// applies.
+type DeviceEndorsement struct {
+	DeviceID string   `json:"DeviceID"`
+	MSPIDs   []string `json:"MSPIDs"`
+}
+
+// GetDeviceEndorsement returns the key-level endorsement policy of a device
+func (s *SmartContract) GetDeviceEndorsement(ctx contractapi.TransactionContextInterface, id string) (*DeviceEndorsement, error) {
+	if err := s.authorizeRead(ctx); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.readDevice(ctx, id); err != nil {
+		return nil, err
+	}
+	key, err := deviceStateKey(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := ctx.GetStub().GetStateValidationParameter(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read endorsement policy of device %s: %v", id, err)
+	}
+
+	mspIDs := []string{}
+	if len(policy) > 0 {
+		ep, err := statebased.NewStateEP(policy)
+		if err != nil {
+			return nil, err
+		}
+		mspIDs = ep.ListOrgs()
+		sort.Strings(mspIDs)
+	}
+	return &DeviceEndorsement{DeviceID: id, MSPIDs: mspIDs}, nil
+}
+
+// SetDeviceEndorsement replaces the key-level endorsement policy of a device
+// with one requiring the peers of every organization in mspIDs, given as a
+// comma separated list. An empty list removes the key-level policy so that
+// the chaincode endorsement policy applies again. The change itself must be
+// endorsed according to the policy being replaced.
+func (s *SmartContract) SetDeviceEndorsement(ctx contractapi.TransactionContextInterface, id string, mspIDs string) error {
+	if err := s.authorizeAdmin(ctx); err != nil {
+		return err
+	}
+
+	if _, err := s.readDevice(ctx, id); err != nil {
+		return err
+	}
+	return setDeviceEndorsement(ctx, id, splitList(mspIDs)...)
+}
+
+// setDeviceEndorsement requires the peers of every given organization to
+// endorse changes to the device, or drops the key-level policy when none are given
+func setDeviceEndorsement(ctx contractapi.TransactionContextInterface, id string, mspIDs ...string) error {
+	var policy []byte
+	if len(mspIDs) > 0 {
+		ep, err := statebased.NewStateEP(nil)
+		if err != nil {
+			return err
+		}
+		if err := ep.AddOrgs(statebased.RoleTypePeer, mspIDs...); err != nil {
+			return err
+		}
+		if policy, err = ep.Policy(); err != nil {
+			return fmt.Errorf("failed to build endorsement policy: %v", err)
+		}
+	}
+
+	key, err := deviceStateKey(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().SetStateValidationParameter(key, policy); err != nil {
+		return fmt.Errorf("failed to set endorsement policy of device %s: %v", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func (l *ledger) endorsement(id string) []string {
+	l.t.Helper()
+	var endorsement *chaincode.DeviceEndorsement
+	require.NoError(l.t, l.evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		endorsement, err = l.contract.GetDeviceEndorsement(ctx, id)
+		return err
+	}))
+	require.Equal(l.t, id, endorsement.DeviceID)
+	return endorsement.MSPIDs
+}
+
+func TestDeviceEndorsement(t *testing.T) {
+	l := newLedger(t)
+	l.register("D1")
+	require.Equal(t, []string{"Org1MSP"}, l.endorsement("D1"))
+
+	require.NoError(t, l.transfer("D1", "Org2MSP"))
+	require.Equal(t, []string{"Org2MSP"}, l.endorsement("D1"))
+
+	setEndorsement := func(id string, mspIDs string) error {
+		return l.submit(func(ctx contractapi.TransactionContextInterface) error {
+			return l.contract.SetDeviceEndorsement(ctx, id, mspIDs)
+		})
+	}
+	require.EqualError(t, setEndorsement("D1", "Org1MSP"), "access denied: the attribute role=ledger-admin is required to administer devices")
+
+	l.as(org1LedgerAdmin)
+	require.NoError(t, setEndorsement("D1", "Org2MSP, Org1MSP"))
+	require.Equal(t, []string{"Org1MSP", "Org2MSP"}, l.endorsement("D1"))
+	require.NoError(t, setEndorsement("D1", ""))
+	require.Equal(t, []string{}, l.endorsement("D1"))
+	require.EqualError(t, setEndorsement("D2", "Org1MSP"), "the device D2 does not exist")
+}
@@ -0,0 +1,86 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Names of the chaincode events emitted for device lifecycle changes
+const (
+	EventDeviceRegistered        = "DeviceRegistered"
+	EventDeviceUpdated           = "DeviceUpdated"
+	EventDeviceDeleted           = "DeviceDeleted"
+	EventDeviceKeyRotated        = "DeviceKeyRotated"
+	EventDeviceLockedOut         = "DeviceLockedOut"
+	EventDevicesImported         = "DevicesImported"
+	EventDeviceTransferRequested = "DeviceTransferRequested"
+	EventDeviceTransferred       = "DeviceTransferred"
+	EventDeviceGroupStatus       = "DeviceGroupStatusChanged"
+	EventRevocationSnapshot      = "RevocationSnapshotAnchored"
+	EventChangeProposed          = "DeviceChangeProposed"
+	EventChangeApproved          = "DeviceChangeApproved"
+	EventConfigChanged           = "ContractConfigChanged"
+)
+
+// DeviceEvent is the payload of every device lifecycle event. Events about
+// several devices at once list them in DeviceIDs instead of DeviceID.
+type DeviceEvent struct {
+	Event      string   `json:"Event"`
+	DeviceID   string   `json:"DeviceID,omitempty"`
+	DeviceIDs  []string `json:"DeviceIDs,omitempty"`
+	Group      string   `json:"Group,omitempty"`
+	OldStatus  string   `json:"OldStatus,omitempty"`
+	NewStatus  string   `json:"NewStatus,omitempty"`
+	FromMSP    string   `json:"FromMSP,omitempty"`
+	ToMSP      string   `json:"ToMSP,omitempty"`
+	MerkleRoot string   `json:"MerkleRoot,omitempty"`
+	ProposalID string   `json:"ProposalID,omitempty"`
+	// SuspendedUntil and SuspensionReason are set when a device is suspended
+	SuspendedUntil   string `json:"SuspendedUntil,omitempty"`
+	SuspensionReason string `json:"SuspensionReason,omitempty"`
+	Timestamp        string `json:"Timestamp"`
+}
+
+// emitDeviceEvent sets the chaincode event of the transaction for a single device
+func emitDeviceEvent(ctx contractapi.TransactionContextInterface, name string, id string, oldStatus string, newStatus string) error {
+	return emitEvent(ctx, &DeviceEvent{
+		Event:     name,
+		DeviceID:  id,
+		OldStatus: oldStatus,
+		NewStatus: newStatus,
+	})
+}
+
+// emitEvent stamps the event with the transaction time and sets it as the
+// chaincode event of the transaction. Fabric keeps a single event per
+// transaction, so each transaction should emit at most once.
+func emitEvent(ctx contractapi.TransactionContextInterface, event *DeviceEvent) error {
+	timestamp, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	event.Timestamp = timestamp.Format(time.RFC3339Nano)
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.GetStub().SetEvent(event.Event, eventJSON); err != nil {
+		return fmt.Errorf("failed to set event %s: %v", event.Event, err)
+	}
+	return nil
+}
+
+// txTime returns the transaction timestamp chosen by the client, which is
+// identical on every endorsing peer
+func txTime(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read transaction timestamp: %v", err)
+	}
+	return timestamp.AsTime().UTC(), nil
+}
@@ -0,0 +1,408 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Composite key object types of device groups. Memberships are indexed both
+// ways so that groups can list their members and deleted devices can leave
+// every group they belong to.
+const (
+	groupIndex       = "group~name"
+	groupMemberIndex = "groupmember~group~id"
+	deviceGroupIndex = "devicegroup~id~group"
+)
+
+const (
+	maxGroupNameLength   = 64
+	maxDescriptionLength = 256
+)
+
+// DeviceGroup is a named set of devices, such as the devices of one site
+type DeviceGroup struct {
+	Name        string `json:"Name"`
+	Description string `json:"Description,omitempty" metadata:",optional"`
+	CreatedBy   string `json:"CreatedBy"`
+	CreatedAt   string `json:"CreatedAt"`
+}
+
+// GroupStatusResult reports which members SetGroupStatus moved to the new
+// status and which it left alone
+type GroupStatusResult struct {
+	Group   string           `json:"Group"`
+	Status  string           `json:"Status"`
+	Updated []string         `json:"Updated"`
+	Skipped []*SkippedDevice `json:"Skipped"`
+}
+
+// SkippedDevice explains why a group member kept its status
+type SkippedDevice struct {
+	ID     string `json:"ID"`
+	Reason string `json:"Reason"`
+}
+
+// CreateGroup creates an empty device group
+func (s *SmartContract) CreateGroup(ctx contractapi.TransactionContextInterface, name string, description string) error {
+	if err := s.authorizeWrite(ctx); err != nil {
+		return err
+	}
+
+	if name == "" {
+		return fmt.Errorf("the group name must not be empty")
+	}
+	if err := checkMetadataText("the group name", name, maxGroupNameLength); err != nil {
+		return err
+	}
+	if err := checkMetadataText("the description", description, maxDescriptionLength); err != nil {
+		return err
+	}
+	existing, err := findGroup(ctx, name)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("the group %s already exists", name)
+	}
+	createdBy, err := invokerID(ctx)
+	if err != nil {
+		return err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	group := DeviceGroup{
+		Name:        name,
+		Description: description,
+		CreatedBy:   createdBy,
+		CreatedAt:   now.Format(time.RFC3339),
+	}
+	groupJSON, err := json.Marshal(group)
+	if err != nil {
+		return err
+	}
+	groupKey, err := ctx.GetStub().CreateCompositeKey(groupIndex, []string{name})
+	if err != nil {
+		return fmt.Errorf("failed to create group key: %v", err)
+	}
+	if err := ctx.GetStub().PutState(groupKey, groupJSON); err != nil {
+		return fmt.Errorf("failed to put group: %v", err)
+	}
+	return nil
+}
+
+// DeleteGroup deletes a device group. Its members are left untouched.
+func (s *SmartContract) DeleteGroup(ctx contractapi.TransactionContextInterface, name string) error {
+	if err := s.authorizeWrite(ctx); err != nil {
+		return err
+	}
+
+	if _, err := readGroup(ctx, name); err != nil {
+		return err
+	}
+	members, err := groupMembers(ctx, name)
+	if err != nil {
+		return err
+	}
+	for _, id := range members {
+		if err := delMembership(ctx, name, id); err != nil {
+			return err
+		}
+	}
+
+	groupKey, err := ctx.GetStub().CreateCompositeKey(groupIndex, []string{name})
+	if err != nil {
+		return fmt.Errorf("failed to create group key: %v", err)
+	}
+	if err := ctx.GetStub().DelState(groupKey); err != nil {
+		return fmt.Errorf("failed to delete group: %v", err)
+	}
+	return nil
+}
+
+// GetGroups returns every device group
+func (s *SmartContract) GetGroups(ctx contractapi.TransactionContextInterface) ([]*DeviceGroup, error) {
+	if err := s.authorizeRead(ctx); err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(groupIndex, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var groups []*DeviceGroup
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var group DeviceGroup
+		err = json.Unmarshal(queryResponse.Value, &group)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, &group)
+	}
+
+	return groups, nil
+}
+
+// AddGroupMembers adds the devices in deviceIDs, a comma separated list, to
+// a group. Devices already in the group are ignored.
+func (s *SmartContract) AddGroupMembers(ctx contractapi.TransactionContextInterface, name string, deviceIDs string) error {
+	if err := s.authorizeWrite(ctx); err != nil {
+		return err
+	}
+
+	if _, err := readGroup(ctx, name); err != nil {
+		return err
+	}
+	ids := splitList(deviceIDs)
+	if len(ids) == 0 {
+		return fmt.Errorf("no devices to add to group %s", name)
+	}
+	for _, id := range ids {
+		if _, err := s.readDevice(ctx, id); err != nil {
+			return err
+		}
+		if err := putMembership(ctx, name, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveGroupMembers removes the devices in deviceIDs, a comma separated
+// list, from a group
+func (s *SmartContract) RemoveGroupMembers(ctx contractapi.TransactionContextInterface, name string, deviceIDs string) error {
+	if err := s.authorizeWrite(ctx); err != nil {
+		return err
+	}
+
+	if _, err := readGroup(ctx, name); err != nil {
+		return err
+	}
+	ids := splitList(deviceIDs)
+	if len(ids) == 0 {
+		return fmt.Errorf("no devices to remove from group %s", name)
+	}
+	members, err := groupMembers(ctx, name)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if !contains(members, id) {
+			return fmt.Errorf("the device %s is not a member of group %s", id, name)
+		}
+		if err := delMembership(ctx, name, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetGroupMembers returns the devices of a group
+func (s *SmartContract) GetGroupMembers(ctx contractapi.TransactionContextInterface, name string) ([]*Device_list, error) {
+	if err := s.authorizeRead(ctx); err != nil {
+		return nil, err
+	}
+
+	if _, err := readGroup(ctx, name); err != nil {
+		return nil, err
+	}
+	members, err := groupMembers(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	devices := []*Device_list{}
+	for _, id := range members {
+		asset, err := s.readDevice(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, asset.listing())
+	}
+	return devices, nil
+}
+
+// SetGroupStatus moves every member of a group to status in one
+// transaction. Members for which the move is not allowed by the device
+// lifecycle, including those already in that status, and revoked members,
+// which are only reactivated through ProposeReactivation, are skipped and
+// reported.
+func (s *SmartContract) SetGroupStatus(ctx contractapi.TransactionContextInterface, name string, status string) (*GroupStatusResult, error) {
+	if err := s.authorizeWrite(ctx); err != nil {
+		return nil, err
+	}
+
+	status, err := parseStatus(status)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := readGroup(ctx, name); err != nil {
+		return nil, err
+	}
+	members, err := groupMembers(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return nil, fmt.Errorf("the group %s has no members", name)
+	}
+	updatedBy, err := invokerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := GroupStatusResult{Group: name, Status: status, Updated: []string{}, Skipped: []*SkippedDevice{}}
+	for _, id := range members {
+		asset, err := s.readDevice(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		oldStatus := storedStatus(asset.Status)
+		err = checkTransition(id, oldStatus, status)
+		if err == nil {
+			err = checkUnapproved(id, oldStatus, status)
+		}
+		if err != nil {
+			result.Skipped = append(result.Skipped, &SkippedDevice{ID: id, Reason: err.Error()})
+			continue
+		}
+
+		asset.setStatus(status)
+		asset.UpdatedBy = updatedBy
+		if err := s.putDeviceStatus(ctx, asset, oldStatus); err != nil {
+			return nil, err
+		}
+		result.Updated = append(result.Updated, id)
+	}
+
+	if len(result.Updated) > 0 {
+		err := emitEvent(ctx, &DeviceEvent{
+			Event:     EventDeviceGroupStatus,
+			DeviceIDs: result.Updated,
+			Group:     name,
+			NewStatus: status,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &result, nil
+}
+
+// readGroup returns the group or an error if there is none
+func readGroup(ctx contractapi.TransactionContextInterface, name string) (*DeviceGroup, error) {
+	group, err := findGroup(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if group == nil {
+		return nil, fmt.Errorf("the group %s does not exist", name)
+	}
+	return group, nil
+}
+
+// findGroup returns the group, or nil if there is none
+func findGroup(ctx contractapi.TransactionContextInterface, name string) (*DeviceGroup, error) {
+	groupKey, err := ctx.GetStub().CreateCompositeKey(groupIndex, []string{name})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create group key: %v", err)
+	}
+	groupJSON, err := ctx.GetStub().GetState(groupKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read group: %v", err)
+	}
+	if groupJSON == nil {
+		return nil, nil
+	}
+
+	var group DeviceGroup
+	err = json.Unmarshal(groupJSON, &group)
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// groupMembers returns the IDs of the members of a group in key order
+func groupMembers(ctx contractapi.TransactionContextInterface, name string) ([]string, error) {
+	return indexedIDs(ctx, groupMemberIndex, name)
+}
+
+// leaveGroups removes a device from every group it belongs to
+func leaveGroups(ctx contractapi.TransactionContextInterface, id string) error {
+	groups, err := indexedIDs(ctx, deviceGroupIndex, id)
+	if err != nil {
+		return err
+	}
+	for _, name := range groups {
+		if err := delMembership(ctx, name, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexedIDs returns the second attribute of every key of a two-attribute
+// index whose first attribute is key
+func indexedIDs(ctx contractapi.TransactionContextInterface, index string, key string) ([]string, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(index, []string{key})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var ids []string
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, attributes[1])
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func putMembership(ctx contractapi.TransactionContextInterface, name string, id string) error {
+	for _, key := range [][]string{{groupMemberIndex, name, id}, {deviceGroupIndex, id, name}} {
+		indexKey, err := ctx.GetStub().CreateCompositeKey(key[0], key[1:])
+		if err != nil {
+			return fmt.Errorf("failed to create group membership key: %v", err)
+		}
+		if err := ctx.GetStub().PutState(indexKey, indexMarker); err != nil {
+			return fmt.Errorf("failed to put group membership: %v", err)
+		}
+	}
+	return nil
+}
+
+func delMembership(ctx contractapi.TransactionContextInterface, name string, id string) error {
+	for _, key := range [][]string{{groupMemberIndex, name, id}, {deviceGroupIndex, id, name}} {
+		indexKey, err := ctx.GetStub().CreateCompositeKey(key[0], key[1:])
+		if err != nil {
+			return fmt.Errorf("failed to create group membership key: %v", err)
+		}
+		if err := ctx.GetStub().DelState(indexKey); err != nil {
+			return fmt.Errorf("failed to delete group membership: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func (l *ledger) createGroup(name string, description string) error {
+	return l.submit(func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.CreateGroup(ctx, name, description)
+	})
+}
+
+func (l *ledger) addMembers(name string, deviceIDs string) error {
+	return l.submit(func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.AddGroupMembers(ctx, name, deviceIDs)
+	})
+}
+
+func (l *ledger) groupMembers(name string) []string {
+	l.t.Helper()
+	var devices []*chaincode.Device_list
+	require.NoError(l.t, l.evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		devices, err = l.contract.GetGroupMembers(ctx, name)
+		return err
+	}))
+	ids := []string{}
+	for _, device := range devices {
+		ids = append(ids, device.ID)
+	}
+	return ids
+}
+
+func TestDeviceGroups(t *testing.T) {
+	l := newLedger(t)
+	l.register("D1")
+	l.register("D2")
+	l.register("D3")
+
+	require.NoError(t, l.createGroup("floor-1", "first floor sensors"))
+	require.NoError(t, l.createGroup("floor-2", ""))
+	require.EqualError(t, l.createGroup("floor-1", ""), "the group floor-1 already exists")
+	require.EqualError(t, l.createGroup("", ""), "the group name must not be empty")
+
+	var groups []*chaincode.DeviceGroup
+	require.NoError(t, l.evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		groups, err = l.contract.GetGroups(ctx)
+		return err
+	}))
+	require.Len(t, groups, 2)
+	require.Equal(t, &chaincode.DeviceGroup{
+		Name:        "floor-1",
+		Description: "first floor sensors",
+		CreatedBy:   "Org1MSP/x509::CN=admin::CN=ca.org1.example.com",
+		CreatedAt:   "2024-01-01T00:00:04Z",
+	}, groups[0])
+
+	require.NoError(t, l.addMembers("floor-1", "D1, D2"))
+	require.NoError(t, l.addMembers("floor-1", "D2"))
+	require.NoError(t, l.addMembers("floor-2", "D2,D3"))
+	require.Equal(t, []string{"D1", "D2"}, l.groupMembers("floor-1"))
+	require.EqualError(t, l.addMembers("floor-1", "D9"), "the device D9 does not exist")
+	require.EqualError(t, l.addMembers("floor-1", " , "), "no devices to add to group floor-1")
+	require.EqualError(t, l.addMembers("floor-9", "D1"), "the group floor-9 does not exist")
+
+	removeMembers := func(name string, deviceIDs string) error {
+		return l.submit(func(ctx contractapi.TransactionContextInterface) error {
+			return l.contract.RemoveGroupMembers(ctx, name, deviceIDs)
+		})
+	}
+	require.NoError(t, removeMembers("floor-1", "D1"))
+	require.Equal(t, []string{"D2"}, l.groupMembers("floor-1"))
+	require.EqualError(t, removeMembers("floor-1", "D1"), "the device D1 is not a member of group floor-1")
+
+	// deleting a device takes it out of its groups
+	require.NoError(t, l.delete("D2", false))
+	require.Equal(t, []string{}, l.groupMembers("floor-1"))
+	require.Equal(t, []string{"D3"}, l.groupMembers("floor-2"))
+
+	require.NoError(t, l.submit(func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.DeleteGroup(ctx, "floor-2")
+	}))
+	require.NoError(t, l.createGroup("floor-2", ""))
+	require.Equal(t, []string{}, l.groupMembers("floor-2"))
+}
+
+func TestSetGroupStatus(t *testing.T) {
+	l := newLedger(t)
+	l.register("D1")
+	l.register("D2")
+	l.register("D3")
+	l.update("D3", chaincode.StatusDecommissioned)
+	require.NoError(t, l.createGroup("lab", ""))
+
+	setGroupStatus := func(status string) (*chaincode.GroupStatusResult, error) {
+		var result *chaincode.GroupStatusResult
+		err := l.submit(func(ctx contractapi.TransactionContextInterface) error {
+			var err error
+			result, err = l.contract.SetGroupStatus(ctx, "lab", status)
+			return err
+		})
+		return result, err
+	}
+	_, err := setGroupStatus(chaincode.StatusSuspended)
+	require.EqualError(t, err, "the group lab has no members")
+
+	require.NoError(t, l.addMembers("lab", "D1,D2,D3"))
+	l.update("D2", chaincode.StatusSuspended)
+	result, err := setGroupStatus(chaincode.StatusSuspended)
+	require.NoError(t, err)
+	require.Equal(t, []string{"D1"}, result.Updated)
+	require.Len(t, result.Skipped, 2)
+	require.Equal(t, "D2", result.Skipped[0].ID)
+	require.Equal(t, "D3", result.Skipped[1].ID)
+	require.Equal(t, chaincode.StatusSuspended, l.asset("D1").Status)
+
+	event := l.lastEvent()
+	require.Equal(t, chaincode.EventDeviceGroupStatus, event.Event)
+	require.Equal(t, "lab", event.Group)
+	require.Equal(t, []string{"D1"}, event.DeviceIDs)
+
+	// revoked members are not reactivated without approval
+	l.update("D1", chaincode.StatusRevoked)
+	result, err = setGroupStatus(chaincode.StatusActive)
+	require.NoError(t, err)
+	require.Equal(t, []string{"D2"}, result.Updated)
+	require.Equal(t, "D1", result.Skipped[0].ID)
+	require.Equal(t, "the revoked device D1 can only be reactivated through ProposeReactivation", result.Skipped[0].Reason)
+	require.Equal(t, chaincode.StatusRevoked, l.asset("D1").Status)
+
+	_, err = setGroupStatus("lost")
+	require.Error(t, err)
+}
@@ -0,0 +1,98 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// DeviceHistoryEntry describes one committed version of a device record.
+// The device key is deliberately left out.
+type DeviceHistoryEntry struct {
+	TxID             string `json:"TxID"`
+	Timestamp        string `json:"Timestamp"`
+	IsDelete         bool   `json:"IsDelete"`
+	DeletedAt        string `json:"DeletedAt,omitempty" metadata:",optional"`
+	Status           string `json:"Status,omitempty" metadata:",optional"`
+	KeyVersion       int    `json:"KeyVersion,omitempty" metadata:",optional"`
+	OwnerMSP         string `json:"OwnerMSP,omitempty" metadata:",optional"`
+	UpdatedBy        string `json:"UpdatedBy,omitempty" metadata:",optional"`
+	ValidFrom        string `json:"ValidFrom,omitempty" metadata:",optional"`
+	ValidUntil       string `json:"ValidUntil,omitempty" metadata:",optional"`
+	SuspendedUntil   string `json:"SuspendedUntil,omitempty" metadata:",optional"`
+	SuspensionReason string `json:"SuspensionReason,omitempty" metadata:",optional"`
+}
+
+// GetDeviceHistory returns every committed version of the device, newest
+// first. Versions written under the bare device ID before the device was
+// moved into the device namespace follow the newer ones.
+func (s *SmartContract) GetDeviceHistory(ctx contractapi.TransactionContextInterface, id string) ([]*DeviceHistoryEntry, error) {
+	if err := s.authorizeRead(ctx); err != nil {
+		return nil, err
+	}
+
+	key, err := deviceStateKey(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := keyHistory(ctx, id, key)
+	if err != nil {
+		return nil, err
+	}
+	legacyEntries, err := keyHistory(ctx, id, id)
+	if err != nil {
+		return nil, err
+	}
+	entries = append(entries, legacyEntries...)
+
+	if entries == nil {
+		return nil, fmt.Errorf("the device %s has no history", id)
+	}
+
+	return entries, nil
+}
+
+// keyHistory returns the versions of the device committed under one key
+func keyHistory(ctx contractapi.TransactionContextInterface, id string, key string) ([]*DeviceHistoryEntry, error) {
+	resultsIterator, err := ctx.GetStub().GetHistoryForKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history of device %s: %v", id, err)
+	}
+	defer resultsIterator.Close()
+
+	var entries []*DeviceHistoryEntry
+	for resultsIterator.HasNext() {
+		modification, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		entry := DeviceHistoryEntry{
+			TxID:      modification.TxId,
+			Timestamp: modification.Timestamp.AsTime().UTC().Format(time.RFC3339Nano),
+			IsDelete:  modification.IsDelete,
+		}
+		if !modification.IsDelete {
+			var asset Asset
+			err = json.Unmarshal(modification.Value, &asset)
+			if err != nil {
+				return nil, err
+			}
+			entry.IsDelete = asset.deleted()
+			entry.DeletedAt = asset.DeletedAt
+			entry.Status = asset.Status
+			entry.KeyVersion = asset.KeyVersion
+			entry.OwnerMSP = asset.OwnerMSP
+			entry.UpdatedBy = asset.UpdatedBy
+			entry.ValidFrom = asset.ValidFrom
+			entry.ValidUntil = asset.ValidUntil
+			entry.SuspendedUntil = asset.SuspendedUntil
+			entry.SuspensionReason = asset.SuspensionReason
+		}
+		entries = append(entries, &entry)
+	}
+
+	return entries, nil
+}
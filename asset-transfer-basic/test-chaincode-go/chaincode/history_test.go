@@ -0,0 +1,40 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetDeviceHistory(t *testing.T) {
+	l := newLedger(t)
+	l.register("D1")
+	l.update("D1", chaincode.StatusSuspended)
+	require.NoError(t, l.delete("D1", false))
+
+	var entries []*chaincode.DeviceHistoryEntry
+	require.NoError(t, l.as(org1User).evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		entries, err = l.contract.GetDeviceHistory(ctx, "D1")
+		return err
+	}))
+
+	require.Len(t, entries, 3)
+	require.True(t, entries[0].IsDelete)
+	require.Equal(t, "2024-01-01T00:00:04Z", entries[0].DeletedAt)
+	require.Equal(t, "tx4", entries[0].TxID)
+	require.Equal(t, chaincode.StatusSuspended, entries[1].Status)
+	require.Equal(t, "2024-01-01T00:00:02Z", entries[1].Timestamp)
+	require.Equal(t, chaincode.StatusActive, entries[2].Status)
+	require.Equal(t, 1, entries[2].KeyVersion)
+	require.Equal(t, "Org1MSP", entries[2].OwnerMSP)
+	require.Equal(t, "Org1MSP/x509::CN=admin::CN=ca.org1.example.com", entries[2].UpdatedBy)
+
+	err := l.evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		_, err := l.contract.GetDeviceHistory(ctx, "D2")
+		return err
+	})
+	require.EqualError(t, err, "the device D2 has no history")
+}
@@ -0,0 +1,242 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// statusIndex is the composite key object type of the status~id index
+const statusIndex = "status~id"
+
+// indexMarker is stored as the value of index entries. CouchDB drops keys
+// with a nil value, so a single null byte is used instead.
+var indexMarker = []byte{0x00}
+
+// ListByStatus returns the devices currently in the given status
+func (s *SmartContract) ListByStatus(ctx contractapi.TransactionContextInterface, status string) ([]*Device_list, error) {
+	if err := s.authorizeRead(ctx); err != nil {
+		return nil, err
+	}
+
+	status, err := parseStatus(status)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := listIndexed(ctx, status, status, now)
+	if err != nil {
+		return nil, err
+	}
+	if status == StatusActive {
+		// devices whose suspension ended stay indexed as suspended until
+		// they are next written
+		ended, err := listIndexed(ctx, StatusSuspended, StatusActive, now)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, ended...)
+		sort.Slice(devices, func(i, j int) bool { return devices[i].ID < devices[j].ID })
+	}
+
+	return devices, nil
+}
+
+// listIndexed returns the devices indexed under indexed whose status at now
+// is status. Only a suspension ends by itself, so only the records of
+// suspended devices are read.
+func listIndexed(ctx contractapi.TransactionContextInterface, indexed string, status string, now time.Time) ([]*Device_list, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(statusIndex, []string{indexed})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var devices []*Device_list
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, err
+		}
+		if indexed == StatusSuspended {
+			asset, err := readRecord(ctx, attributes[1])
+			if err != nil {
+				return nil, err
+			}
+			if asset == nil || asset.deleted() || asset.statusAt(now) != status {
+				continue
+			}
+		}
+		devices = append(devices, &Device_list{
+			ID:     attributes[1],
+			Status: status,
+		})
+	}
+
+	return devices, nil
+}
+
+// statusPage returns up to pageSize devices in status starting at bookmark.
+// It pages over the status~id index, so pages are only short at the end.
+// Devices whose suspension ended are still indexed as suspended, so the
+// pages of active devices go on over the suspended entries, keeping those
+// that are active again.
+func statusPage(ctx contractapi.TransactionContextInterface, status string, pageSize int32, bookmark string) (*DevicePage, error) {
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	suspendedKey, err := ctx.GetStub().CreateCompositeKey(statusIndex, []string{StatusSuspended})
+	if err != nil {
+		return nil, err
+	}
+
+	page := &DevicePage{Devices: []*Device_list{}}
+	if status != StatusActive || !strings.HasPrefix(bookmark, suspendedKey) {
+		if err := page.addIndexed(ctx, status, status, pageSize, bookmark, now); err != nil {
+			return nil, err
+		}
+		if status != StatusActive || page.Bookmark != "" {
+			return page, nil
+		}
+		if page.FetchedRecordsCount >= pageSize {
+			page.Bookmark = suspendedKey
+			return page, nil
+		}
+		pageSize -= page.FetchedRecordsCount
+		bookmark = ""
+	}
+	if err := page.addIndexed(ctx, StatusSuspended, StatusActive, pageSize, bookmark, now); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// addIndexed reads up to pageSize entries indexed under indexed from
+// bookmark and adds the devices whose status at now is status to the page
+func (page *DevicePage) addIndexed(ctx contractapi.TransactionContextInterface, indexed string, status string, pageSize int32, bookmark string, now time.Time) error {
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(statusIndex, []string{indexed}, pageSize, bookmark)
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return err
+		}
+		asset, err := readRecord(ctx, attributes[1])
+		if err != nil {
+			return err
+		}
+		if asset == nil || asset.deleted() {
+			continue
+		}
+		asset.endSuspension(now)
+		if storedStatus(asset.Status) != status {
+			continue
+		}
+		page.Devices = append(page.Devices, asset.listing())
+	}
+
+	page.FetchedRecordsCount += responseMetadata.FetchedRecordsCount
+	page.Bookmark = responseMetadata.Bookmark
+	return nil
+}
+
+// RebuildStatusIndex drops every status~id entry and indexes each device
+// again. It is meant to be run once on ledgers written before the index
+// existed and returns the number of devices indexed.
+func (s *SmartContract) RebuildStatusIndex(ctx contractapi.TransactionContextInterface) (int, error) {
+	if err := s.authorizeWrite(ctx); err != nil {
+		return 0, err
+	}
+
+	indexIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(statusIndex, []string{})
+	if err != nil {
+		return 0, err
+	}
+	defer indexIterator.Close()
+
+	for indexIterator.HasNext() {
+		queryResponse, err := indexIterator.Next()
+		if err != nil {
+			return 0, err
+		}
+		if err := ctx.GetStub().DelState(queryResponse.Key); err != nil {
+			return 0, fmt.Errorf("failed to delete index entry: %v", err)
+		}
+	}
+
+	resultsIterator, err := deviceIterator(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer resultsIterator.Close()
+
+	count := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return 0, err
+		}
+
+		var asset Asset
+		err = json.Unmarshal(queryResponse.Value, &asset)
+		if err != nil {
+			return 0, err
+		}
+		if asset.deleted() {
+			continue
+		}
+		if err := putStatusIndex(ctx, storedStatus(asset.Status), asset.ID); err != nil {
+			return 0, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// putStatusIndex adds the device to the status~id index
+func putStatusIndex(ctx contractapi.TransactionContextInterface, status string, id string) error {
+	indexKey, err := ctx.GetStub().CreateCompositeKey(statusIndex, []string{status, id})
+	if err != nil {
+		return fmt.Errorf("failed to create index key: %v", err)
+	}
+	if err := ctx.GetStub().PutState(indexKey, indexMarker); err != nil {
+		return fmt.Errorf("failed to put index entry: %v", err)
+	}
+	return nil
+}
+
+// delStatusIndex removes the device from the status~id index
+func delStatusIndex(ctx contractapi.TransactionContextInterface, status string, id string) error {
+	indexKey, err := ctx.GetStub().CreateCompositeKey(statusIndex, []string{status, id})
+	if err != nil {
+		return fmt.Errorf("failed to create index key: %v", err)
+	}
+	if err := ctx.GetStub().DelState(indexKey); err != nil {
+		return fmt.Errorf("failed to delete index entry: %v", err)
+	}
+	return nil
+}
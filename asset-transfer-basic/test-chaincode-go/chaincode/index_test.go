@@ -0,0 +1,59 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func (l *ledger) listByStatus(status string) []string {
+	l.t.Helper()
+	var devices []*chaincode.Device_list
+	require.NoError(l.t, l.evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		devices, err = l.contract.ListByStatus(ctx, status)
+		return err
+	}))
+
+	var ids []string
+	for _, device := range devices {
+		require.Equal(l.t, status, device.Status)
+		ids = append(ids, device.ID)
+	}
+	return ids
+}
+
+func TestListByStatus(t *testing.T) {
+	l := newLedger(t)
+	l.register("D1")
+	l.register("D2")
+	l.register("D3")
+	l.update("D2", chaincode.StatusSuspended)
+
+	require.Equal(t, []string{"D1", "D3"}, l.listByStatus(chaincode.StatusActive))
+	require.Equal(t, []string{"D2"}, l.listByStatus(chaincode.StatusSuspended))
+	require.Empty(t, l.listByStatus(chaincode.StatusRevoked))
+
+	require.NoError(t, l.delete("D3", false))
+	require.Equal(t, []string{"D1"}, l.listByStatus(chaincode.StatusActive))
+}
+
+func TestRebuildStatusIndex(t *testing.T) {
+	l := newLedger(t)
+	key, err := l.stub.CreateCompositeKey("device", []string{"D0"})
+	require.NoError(t, err)
+	l.stub.PutCommittedState(key, []byte(`{"ID":"D0","Status":"Admin"}`))
+	l.register("D1")
+	require.Empty(t, l.listByStatus(chaincode.StatusPending))
+
+	var count int
+	require.NoError(t, l.submit(func(ctx contractapi.TransactionContextInterface) error {
+		count, err = l.contract.RebuildStatusIndex(ctx)
+		return err
+	}))
+	require.Equal(t, 2, count)
+	require.Equal(t, []string{"D0"}, l.listByStatus(chaincode.StatusPending))
+	require.Equal(t, []string{"D1"}, l.listByStatus(chaincode.StatusActive))
+}
@@ -0,0 +1,151 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// lockoutIndex is the composite key object type of the lockout records
+const lockoutIndex = "lockout~id"
+
+// Lockout defaults used when the Config does not set them
+const (
+	DefaultLockoutThreshold = 5
+	DefaultLockoutDuration  = 15 * time.Minute
+)
+
+// Lockout counts the consecutive failed authentications of a device. Once
+// the count reaches the threshold Auth rejects the device until LockedUntil.
+type Lockout struct {
+	DeviceID    string `json:"DeviceID"`
+	Failures    int    `json:"Failures"`
+	LockedUntil string `json:"LockedUntil,omitempty" metadata:",optional"`
+}
+
+// GetLockout returns the failure counter of a device
+func (s *SmartContract) GetLockout(ctx contractapi.TransactionContextInterface, id string) (*Lockout, error) {
+	if err := s.authorizeRead(ctx); err != nil {
+		return nil, err
+	}
+
+	return readLockout(ctx, id)
+}
+
+// ClearLockout resets the failure counter of a device and lifts its lockout
+func (s *SmartContract) ClearLockout(ctx contractapi.TransactionContextInterface, id string) error {
+	if err := s.authorizeWrite(ctx); err != nil {
+		return err
+	}
+
+	if _, err := s.readDevice(ctx, id); err != nil {
+		return err
+	}
+	return putLockout(ctx, &Lockout{DeviceID: id})
+}
+
+// countAttempt updates the failure counter of a device after an
+// authentication attempt. It reports whether the attempt locked the device.
+func (s *SmartContract) countAttempt(ctx contractapi.TransactionContextInterface, id string, outcome string, now time.Time) (bool, error) {
+	lockout, err := readLockout(ctx, id)
+	if err != nil {
+		return false, err
+	}
+
+	if outcome == OutcomeSuccess {
+		lockout.Failures = 0
+		lockout.LockedUntil = ""
+		return false, putLockout(ctx, lockout)
+	}
+
+	lockedUntil, err := lockout.lockedUntil()
+	if err != nil {
+		return false, err
+	}
+	if !lockedUntil.IsZero() && !now.Before(lockedUntil) {
+		// the previous lockout is over, start counting again
+		lockout.Failures = 0
+		lockout.LockedUntil = ""
+	}
+
+	config, err := readConfig(ctx)
+	if err != nil {
+		return false, err
+	}
+	lockout.Failures++
+	locked := lockout.LockedUntil == "" && lockout.Failures >= config.lockoutThreshold()
+	if locked {
+		lockout.LockedUntil = now.Add(config.lockoutDuration()).Format(time.RFC3339)
+	}
+	return locked, putLockout(ctx, lockout)
+}
+
+// checkLockout returns an error while the device is locked out
+func checkLockout(ctx contractapi.TransactionContextInterface, id string, now time.Time) error {
+	lockout, err := readLockout(ctx, id)
+	if err != nil {
+		return err
+	}
+	lockedUntil, err := lockout.lockedUntil()
+	if err != nil {
+		return err
+	}
+	if now.Before(lockedUntil) {
+		return fmt.Errorf("the device %s is locked out after %d failed authentications until %s", id, lockout.Failures, lockout.LockedUntil)
+	}
+	return nil
+}
+
+func (lockout *Lockout) lockedUntil() (time.Time, error) {
+	if lockout.LockedUntil == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, lockout.LockedUntil)
+}
+
+// readLockout returns the lockout record of a device, or an empty one
+func readLockout(ctx contractapi.TransactionContextInterface, id string) (*Lockout, error) {
+	lockoutKey, err := ctx.GetStub().CreateCompositeKey(lockoutIndex, []string{id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create lockout key: %v", err)
+	}
+	lockoutJSON, err := ctx.GetStub().GetState(lockoutKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lockout: %v", err)
+	}
+	if lockoutJSON == nil {
+		return &Lockout{DeviceID: id}, nil
+	}
+
+	var lockout Lockout
+	err = json.Unmarshal(lockoutJSON, &lockout)
+	if err != nil {
+		return nil, err
+	}
+	return &lockout, nil
+}
+
+// putLockout stores the lockout record, dropping it once nothing is left to track
+func putLockout(ctx contractapi.TransactionContextInterface, lockout *Lockout) error {
+	lockoutKey, err := ctx.GetStub().CreateCompositeKey(lockoutIndex, []string{lockout.DeviceID})
+	if err != nil {
+		return fmt.Errorf("failed to create lockout key: %v", err)
+	}
+	if lockout.Failures == 0 && lockout.LockedUntil == "" {
+		if err := ctx.GetStub().DelState(lockoutKey); err != nil {
+			return fmt.Errorf("failed to delete lockout: %v", err)
+		}
+		return nil
+	}
+
+	lockoutJSON, err := json.Marshal(lockout)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutState(lockoutKey, lockoutJSON); err != nil {
+		return fmt.Errorf("failed to put lockout: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package chaincode_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func (l *ledger) lockout(id string) *chaincode.Lockout {
+	l.t.Helper()
+	var lockout *chaincode.Lockout
+	require.NoError(l.t, l.evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		lockout, err = l.contract.GetLockout(ctx, id)
+		return err
+	}))
+	return lockout
+}
+
+func TestLockout(t *testing.T) {
+	l := newLedger(t)
+	l.configure(chaincode.Config{LockoutThreshold: 3, LockoutDuration: "1m"})
+	l.register("D1")
+
+	l.recordAttempt("D1", chaincode.OutcomeFailure, "bad cipher")
+	l.recordAttempt("D1", chaincode.OutcomeSuccess, "")
+	require.Equal(t, &chaincode.Lockout{DeviceID: "D1"}, l.lockout("D1"))
+
+	for i := 0; i < 3; i++ {
+		l.recordAttempt("D1", chaincode.OutcomeFailure, "bad cipher")
+	}
+	lockout := l.lockout("D1")
+	require.Equal(t, 3, lockout.Failures)
+	require.Equal(t, "2024-01-01T00:01:06Z", lockout.LockedUntil)
+	require.Equal(t, chaincode.EventDeviceLockedOut, l.lastEvent().Event)
+
+	_, err := l.auth("D1")
+	require.EqualError(t, err, "the device D1 is locked out after 3 failed authentications until 2024-01-01T00:01:06Z")
+
+	l.stub.Timestamp = l.stub.Timestamp.Add(time.Minute)
+	_, err = l.auth("D1")
+	require.NoError(t, err)
+
+	// the next failure after the lockout starts a new count
+	l.recordAttempt("D1", chaincode.OutcomeFailure, "bad cipher")
+	lockout = l.lockout("D1")
+	require.Equal(t, 1, lockout.Failures)
+	require.Empty(t, lockout.LockedUntil)
+}
+
+func TestClearLockout(t *testing.T) {
+	l := newLedger(t)
+	l.configure(chaincode.Config{LockoutThreshold: 1})
+	l.register("D1")
+	l.recordAttempt("D1", chaincode.OutcomeFailure, "")
+	_, err := l.auth("D1")
+	require.Error(t, err)
+
+	clear := func(id string) error {
+		return l.submit(func(ctx contractapi.TransactionContextInterface) error {
+			return l.contract.ClearLockout(ctx, id)
+		})
+	}
+	require.Error(t, l.as(org1User).submit(func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.ClearLockout(ctx, "D1")
+	}))
+	require.NoError(t, l.as(org1Admin).submit(func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.ClearLockout(ctx, "D1")
+	}))
+	_, err = l.auth("D1")
+	require.NoError(t, err)
+	require.EqualError(t, clear("D2"), "the device D2 does not exist")
+}
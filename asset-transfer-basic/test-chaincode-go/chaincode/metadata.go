@@ -0,0 +1,190 @@
+package chaincode
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// deviceSchemaVersion is the version of the device record written by putDevice.
+// Version 1 records hold only ID, Status and key material and carry no
+// SchemaVersion field.
+const deviceSchemaVersion = 2
+
+const (
+	maxMetadataLength = 64
+	maxTags           = 16
+	maxTagLength      = 32
+)
+
+var tagPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]+$`)
+
+// DeviceMetadata describes the hardware and deployment of a device
+type DeviceMetadata struct {
+	Firmware string   `json:"Firmware,omitempty"`
+	MAC      string   `json:"MAC,omitempty"`
+	Model    string   `json:"Model,omitempty"`
+	Owner    string   `json:"Owner,omitempty"`
+	Site     string   `json:"Site,omitempty"`
+	Tags     []string `json:"Tags,omitempty"`
+}
+
+// parseMetadata applies a JSON object of metadata fields on top of base and
+// validates the result. Fields missing from the object keep their value in
+// base, so the same call serves registrations and partial updates.
+func parseMetadata(base DeviceMetadata, metadataJSON string) (DeviceMetadata, error) {
+	metadata := base
+	if strings.TrimSpace(metadataJSON) != "" {
+		decoder := json.NewDecoder(bytes.NewReader([]byte(metadataJSON)))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&metadata); err != nil {
+			return DeviceMetadata{}, fmt.Errorf("invalid device metadata: %v", err)
+		}
+	}
+	if err := metadata.normalize(); err != nil {
+		return DeviceMetadata{}, err
+	}
+	return metadata, nil
+}
+
+// normalize validates the metadata in place, canonicalising the MAC address
+// and sorting and de-duplicating the tags
+func (metadata *DeviceMetadata) normalize() error {
+	fields := []struct {
+		name  string
+		value *string
+	}{
+		{"Firmware", &metadata.Firmware},
+		{"Model", &metadata.Model},
+		{"Owner", &metadata.Owner},
+		{"Site", &metadata.Site},
+	}
+	for _, field := range fields {
+		*field.value = strings.TrimSpace(*field.value)
+		if err := checkMetadataText(field.name, *field.value, maxMetadataLength); err != nil {
+			return err
+		}
+	}
+
+	if metadata.MAC = strings.TrimSpace(metadata.MAC); metadata.MAC != "" {
+		mac, err := net.ParseMAC(metadata.MAC)
+		if err != nil || len(mac) != 6 {
+			return fmt.Errorf("invalid MAC address %q, expected six hex octets such as 24:6f:28:aa:bb:cc", metadata.MAC)
+		}
+		metadata.MAC = mac.String()
+	}
+
+	seen := map[string]bool{}
+	var tags []string
+	for _, tag := range metadata.Tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > maxTagLength || !tagPattern.MatchString(tag) {
+			return fmt.Errorf("invalid tag %q, tags are up to %d letters, digits or . _ : - characters", tag, maxTagLength)
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	if len(tags) > maxTags {
+		return fmt.Errorf("a device may have at most %d tags, got %d", maxTags, len(tags))
+	}
+	sort.Strings(tags)
+	metadata.Tags = tags
+
+	return nil
+}
+
+func checkMetadataText(name string, value string, maxLength int) error {
+	if len(value) > maxLength {
+		return fmt.Errorf("%s must be at most %d characters long", name, maxLength)
+	}
+	for _, r := range value {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("%s must not contain control characters", name)
+		}
+	}
+	return nil
+}
+
+// metadata returns the metadata fields of the device
+func (asset *Asset) metadata() DeviceMetadata {
+	return DeviceMetadata{
+		Firmware: asset.Firmware,
+		MAC:      asset.MAC,
+		Model:    asset.Model,
+		Owner:    asset.Owner,
+		Site:     asset.Site,
+		Tags:     asset.Tags,
+	}
+}
+
+// setMetadata replaces the metadata fields of the device
+func (asset *Asset) setMetadata(metadata DeviceMetadata) {
+	asset.Firmware = metadata.Firmware
+	asset.MAC = metadata.MAC
+	asset.Model = metadata.Model
+	asset.Owner = metadata.Owner
+	asset.Site = metadata.Site
+	asset.Tags = metadata.Tags
+}
+
+// MigrateDeviceSchema upgrades every device record written before schema
+// versioning to the current schema and returns how many were upgraded.
+// Records still holding a key in public state must be migrated with
+// MigrateDeviceKeys first.
+func (s *SmartContract) MigrateDeviceSchema(ctx contractapi.TransactionContextInterface) (int, error) {
+	if err := s.authorizeWrite(ctx); err != nil {
+		return 0, err
+	}
+
+	resultsIterator, err := deviceIterator(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer resultsIterator.Close()
+
+	count := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return 0, err
+		}
+
+		var legacy legacyAsset
+		err = json.Unmarshal(queryResponse.Value, &legacy)
+		if err != nil {
+			return 0, err
+		}
+		if legacy.SchemaVersion >= deviceSchemaVersion {
+			continue
+		}
+		if legacy.Key != "" {
+			return 0, fmt.Errorf("the device %s still holds its key in public state, run MigrateDeviceKeys first", legacy.ID)
+		}
+
+		asset := legacy.Asset
+		if status := storedStatus(asset.Status); contains(statuses, status) {
+			asset.Status = status
+		}
+		metadata := asset.metadata()
+		if err := metadata.normalize(); err != nil {
+			return 0, fmt.Errorf("the device %s cannot be migrated: %v", asset.ID, err)
+		}
+		asset.setMetadata(metadata)
+		if err := s.putDevice(ctx, &asset); err != nil {
+			return 0, err
+		}
+		count++
+	}
+
+	return count, nil
+}
@@ -0,0 +1,78 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeviceMetadata(t *testing.T) {
+	l := newLedger(t)
+	l.stub.Transient = map[string][]byte{"key": []byte(testKey)}
+	require.NoError(t, l.submit(func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.Register(ctx, "D1", chaincode.StatusActive, "", "",
+			`{"Firmware": "1.0.2", "MAC": "24-6F-28-AA-BB-CC", "Model": " esp32 ", "Tags": ["lab", "floor-1", "lab"]}`, "", "")
+	}))
+
+	asset := l.asset("D1")
+	require.Equal(t, 2, asset.SchemaVersion)
+	require.Equal(t, "1.0.2", asset.Firmware)
+	require.Equal(t, "24:6f:28:aa:bb:cc", asset.MAC)
+	require.Equal(t, "esp32", asset.Model)
+	require.Equal(t, []string{"floor-1", "lab"}, asset.Tags)
+
+	// fields left out of an update are kept
+	require.NoError(t, l.submit(func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.Update(ctx, "D1", "", `{"Firmware": "1.1.0", "Site": "lab 2"}`)
+	}))
+	asset = l.asset("D1")
+	require.Equal(t, chaincode.StatusActive, asset.Status)
+	require.Equal(t, "1.1.0", asset.Firmware)
+	require.Equal(t, "lab 2", asset.Site)
+	require.Equal(t, "esp32", asset.Model)
+
+	update := func(metadataJSON string) error {
+		return l.submit(func(ctx contractapi.TransactionContextInterface) error {
+			return l.contract.Update(ctx, "D1", "", metadataJSON)
+		})
+	}
+	require.EqualError(t, update(`{"MAC": "24:6f:28"}`), `invalid MAC address "24:6f:28", expected six hex octets such as 24:6f:28:aa:bb:cc`)
+	require.EqualError(t, update(`{"Tags": ["no spaces"]}`), `invalid tag "no spaces", tags are up to 32 letters, digits or . _ : - characters`)
+	require.EqualError(t, update(`{"Owner": "tab\there"}`), "Owner must not contain control characters")
+	require.Contains(t, update(`{"Colour": "red"}`).Error(), "invalid device metadata")
+	require.EqualError(t, update(""), "nothing to update for device D1")
+}
+
+func TestMigrateDeviceSchema(t *testing.T) {
+	l := newLedger(t)
+	key, err := l.stub.CreateCompositeKey("device", []string{"D0"})
+	require.NoError(t, err)
+	l.stub.PutCommittedState(key, []byte(`{"ID":"D0","Status":"Active","KeyType":"AES","KeyVersion":1}`))
+	l.register("D1")
+
+	migrate := func() (int, error) {
+		var count int
+		err := l.submit(func(ctx contractapi.TransactionContextInterface) error {
+			var err error
+			count, err = l.contract.MigrateDeviceSchema(ctx)
+			return err
+		})
+		return count, err
+	}
+	count, err := migrate()
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+	asset := l.asset("D0")
+	require.Equal(t, 2, asset.SchemaVersion)
+	require.Equal(t, chaincode.StatusActive, asset.Status)
+
+	count, err = migrate()
+	require.NoError(t, err)
+	require.Zero(t, count)
+
+	l.stub.PutCommittedState(key, []byte(`{"ID":"D0","Status":"active","Key":"`+testKey+`"}`))
+	_, err = migrate()
+	require.EqualError(t, err, "the device D0 still holds its key in public state, run MigrateDeviceKeys first")
+}
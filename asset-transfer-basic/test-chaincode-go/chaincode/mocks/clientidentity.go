@@ -0,0 +1,45 @@
+package mocks
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+)
+
+// ClientIdentity is a cid.ClientIdentity with fixed values for contract tests
+type ClientIdentity struct {
+	MSPID string
+	// ID is the client ID before base64 encoding, such as
+	// x509::CN=admin::CN=ca.org1.example.com
+	ID          string
+	Attributes  map[string]string
+	Certificate *x509.Certificate
+}
+
+func (c *ClientIdentity) GetID() (string, error) {
+	return base64.StdEncoding.EncodeToString([]byte(c.ID)), nil
+}
+
+func (c *ClientIdentity) GetMSPID() (string, error) {
+	return c.MSPID, nil
+}
+
+func (c *ClientIdentity) GetAttributeValue(attrName string) (string, bool, error) {
+	value, found := c.Attributes[attrName]
+	return value, found, nil
+}
+
+func (c *ClientIdentity) AssertAttributeValue(attrName, attrValue string) error {
+	value, found := c.Attributes[attrName]
+	if !found {
+		return fmt.Errorf("attribute '%s' was not found", attrName)
+	}
+	if value != attrValue {
+		return fmt.Errorf("attribute '%s' equals '%s', not '%s'", attrName, value, attrValue)
+	}
+	return nil
+}
+
+func (c *ClientIdentity) GetX509Certificate() (*x509.Certificate, error) {
+	return c.Certificate, nil
+}
@@ -0,0 +1,541 @@
+package mocks
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// MemoryStub is an in-memory shim.ChaincodeStubInterface for contract tests.
+// Unlike the generated ChaincodeStub it keeps world state, private data, key
+// history, endorsement policies and events across calls, so a test can run
+// several transactions against the same ledger.
+//
+// Transactions follow Fabric semantics: Begin starts one, writes are
+// buffered in its write set and are not visible to its own reads, and
+// Commit applies them to the ledger while Rollback drops them. Like a peer
+// backed by LevelDB, rich queries are not supported.
+type MemoryStub struct {
+	ChannelID string
+	TxID      string
+	// Timestamp is returned by GetTxTimestamp
+	Timestamp time.Time
+	// Transient is the transient map of the current transaction. It is
+	// cleared when the transaction ends.
+	Transient map[string][]byte
+	Args      [][]byte
+	Creator   []byte
+	// Events holds the event of every committed transaction that set one
+	Events []*peer.ChaincodeEvent
+	// Queries holds every rich query received, although none is run
+	Queries []string
+
+	state      map[stateKey][]byte
+	validation map[stateKey][]byte
+	history    map[string][]*queryresult.KeyModification
+
+	writes      map[stateKey]*stateWrite
+	validations map[stateKey][]byte
+	event       *peer.ChaincodeEvent
+}
+
+// stateKey identifies a key of the world state, where collection is empty,
+// or of a private data collection
+type stateKey struct {
+	collection string
+	key        string
+}
+
+type stateWrite struct {
+	value    []byte
+	isDelete bool
+}
+
+// NewMemoryStub returns an empty ledger on channel mychannel
+func NewMemoryStub() *MemoryStub {
+	return &MemoryStub{
+		ChannelID:   "mychannel",
+		Timestamp:   time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+		state:       map[stateKey][]byte{},
+		validation:  map[stateKey][]byte{},
+		history:     map[string][]*queryresult.KeyModification{},
+		writes:      map[stateKey]*stateWrite{},
+		validations: map[stateKey][]byte{},
+	}
+}
+
+// Begin starts a transaction, dropping anything left over from the previous one
+func (s *MemoryStub) Begin(txID string) {
+	s.TxID = txID
+	s.writes = map[stateKey]*stateWrite{}
+	s.validations = map[stateKey][]byte{}
+	s.event = nil
+}
+
+// Commit applies the write set, endorsement policies and event of the
+// current transaction to the ledger
+func (s *MemoryStub) Commit() {
+	keys := make([]stateKey, 0, len(s.writes))
+	for key := range s.writes {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].collection != keys[j].collection {
+			return keys[i].collection < keys[j].collection
+		}
+		return keys[i].key < keys[j].key
+	})
+
+	for _, key := range keys {
+		write := s.writes[key]
+		if write.isDelete {
+			delete(s.state, key)
+			delete(s.validation, key)
+		} else {
+			s.state[key] = write.value
+		}
+		if key.collection == "" {
+			s.history[key.key] = append(s.history[key.key], &queryresult.KeyModification{
+				TxId:      s.TxID,
+				Value:     write.value,
+				Timestamp: timestamppb.New(s.Timestamp),
+				IsDelete:  write.isDelete,
+			})
+		}
+	}
+	for key, policy := range s.validations {
+		if len(policy) == 0 {
+			delete(s.validation, key)
+		} else {
+			s.validation[key] = policy
+		}
+	}
+	if s.event != nil {
+		s.Events = append(s.Events, s.event)
+	}
+
+	s.end()
+}
+
+// Rollback drops the write set, endorsement policies and event of the
+// current transaction
+func (s *MemoryStub) Rollback() {
+	s.end()
+}
+
+func (s *MemoryStub) end() {
+	s.writes = map[stateKey]*stateWrite{}
+	s.validations = map[stateKey][]byte{}
+	s.event = nil
+	s.Transient = nil
+}
+
+// LastEvent returns the event of the last committed transaction that set one
+func (s *MemoryStub) LastEvent() *peer.ChaincodeEvent {
+	if len(s.Events) == 0 {
+		return nil
+	}
+	return s.Events[len(s.Events)-1]
+}
+
+// Keys returns the committed world state keys in order
+func (s *MemoryStub) Keys() []string {
+	var keys []string
+	for key := range s.state {
+		if key.collection == "" {
+			keys = append(keys, key.key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// PutCommittedState writes a value straight to the ledger, outside of any
+// transaction, to set up ledgers written by older chaincode
+func (s *MemoryStub) PutCommittedState(key string, value []byte) {
+	s.state[stateKey{key: key}] = value
+	s.history[key] = append(s.history[key], &queryresult.KeyModification{
+		TxId:      "setup",
+		Value:     value,
+		Timestamp: timestamppb.New(s.Timestamp),
+	})
+}
+
+func (s *MemoryStub) GetArgs() [][]byte {
+	return s.Args
+}
+
+func (s *MemoryStub) GetStringArgs() []string {
+	args := make([]string, len(s.Args))
+	for i, arg := range s.Args {
+		args[i] = string(arg)
+	}
+	return args
+}
+
+func (s *MemoryStub) GetFunctionAndParameters() (string, []string) {
+	args := s.GetStringArgs()
+	if len(args) == 0 {
+		return "", []string{}
+	}
+	return args[0], args[1:]
+}
+
+func (s *MemoryStub) GetArgsSlice() ([]byte, error) {
+	var slice []byte
+	for _, arg := range s.Args {
+		slice = append(slice, arg...)
+	}
+	return slice, nil
+}
+
+func (s *MemoryStub) GetTxID() string {
+	return s.TxID
+}
+
+func (s *MemoryStub) GetChannelID() string {
+	return s.ChannelID
+}
+
+func (s *MemoryStub) InvokeChaincode(chaincodeName string, args [][]byte, channel string) peer.Response {
+	return peer.Response{
+		Status:  shim.ERROR,
+		Message: "InvokeChaincode is not supported by MemoryStub",
+	}
+}
+
+func (s *MemoryStub) GetState(key string) ([]byte, error) {
+	return s.read("", key)
+}
+
+func (s *MemoryStub) PutState(key string, value []byte) error {
+	return s.write("", key, value, false)
+}
+
+func (s *MemoryStub) DelState(key string) error {
+	return s.write("", key, nil, true)
+}
+
+func (s *MemoryStub) SetStateValidationParameter(key string, ep []byte) error {
+	s.validations[stateKey{key: key}] = ep
+	return nil
+}
+
+func (s *MemoryStub) GetStateValidationParameter(key string) ([]byte, error) {
+	return s.validation[stateKey{key: key}], nil
+}
+
+func (s *MemoryStub) GetStateByRange(startKey, endKey string) (shim.StateQueryIteratorInterface, error) {
+	if err := validateSimpleKeys(startKey, endKey); err != nil {
+		return nil, err
+	}
+	if startKey == "" {
+		startKey = "\x01"
+	}
+	return &memoryIterator{results: s.scan("", startKey, endKey)}, nil
+}
+
+func (s *MemoryStub) GetStateByRangeWithPagination(startKey, endKey string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	if err := validateSimpleKeys(startKey, endKey); err != nil {
+		return nil, nil, err
+	}
+	if startKey == "" {
+		startKey = "\x01"
+	}
+	return s.page("", startKey, endKey, pageSize, bookmark)
+}
+
+func (s *MemoryStub) GetStateByPartialCompositeKey(objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	startKey, endKey, err := partialKeyRange(objectType, keys)
+	if err != nil {
+		return nil, err
+	}
+	return &memoryIterator{results: s.scan("", startKey, endKey)}, nil
+}
+
+func (s *MemoryStub) GetStateByPartialCompositeKeyWithPagination(objectType string, keys []string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	startKey, endKey, err := partialKeyRange(objectType, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.page("", startKey, endKey, pageSize, bookmark)
+}
+
+func (s *MemoryStub) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	return shim.CreateCompositeKey(objectType, attributes)
+}
+
+func (s *MemoryStub) SplitCompositeKey(compositeKey string) (string, []string, error) {
+	if !strings.HasPrefix(compositeKey, "\x00") || !strings.HasSuffix(compositeKey, "\x00") {
+		return "", nil, fmt.Errorf("%q is not a composite key", compositeKey)
+	}
+	components := strings.Split(compositeKey[1:len(compositeKey)-1], "\x00")
+	return components[0], components[1:], nil
+}
+
+func (s *MemoryStub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	s.Queries = append(s.Queries, query)
+	return nil, fmt.Errorf("ExecuteQuery not supported for leveldb")
+}
+
+func (s *MemoryStub) GetQueryResultWithPagination(query string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	s.Queries = append(s.Queries, query)
+	return nil, nil, fmt.Errorf("ExecuteQuery not supported for leveldb")
+}
+
+// GetHistoryForKey returns the committed versions of a key, newest first
+func (s *MemoryStub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	modifications := s.history[key]
+	results := make([]*queryresult.KeyModification, len(modifications))
+	for i, modification := range modifications {
+		results[len(modifications)-1-i] = modification
+	}
+	return &historyIterator{results: results}, nil
+}
+
+func (s *MemoryStub) GetPrivateData(collection, key string) ([]byte, error) {
+	if collection == "" {
+		return nil, fmt.Errorf("collection must not be an empty string")
+	}
+	return s.read(collection, key)
+}
+
+func (s *MemoryStub) GetPrivateDataHash(collection, key string) ([]byte, error) {
+	value, err := s.GetPrivateData(collection, key)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(value)
+	return hash[:], nil
+}
+
+func (s *MemoryStub) PutPrivateData(collection string, key string, value []byte) error {
+	if collection == "" {
+		return fmt.Errorf("collection must not be an empty string")
+	}
+	return s.write(collection, key, value, false)
+}
+
+func (s *MemoryStub) DelPrivateData(collection, key string) error {
+	if collection == "" {
+		return fmt.Errorf("collection must not be an empty string")
+	}
+	return s.write(collection, key, nil, true)
+}
+
+func (s *MemoryStub) PurgePrivateData(collection, key string) error {
+	return s.DelPrivateData(collection, key)
+}
+
+func (s *MemoryStub) SetPrivateDataValidationParameter(collection, key string, ep []byte) error {
+	s.validations[stateKey{collection: collection, key: key}] = ep
+	return nil
+}
+
+func (s *MemoryStub) GetPrivateDataValidationParameter(collection, key string) ([]byte, error) {
+	return s.validation[stateKey{collection: collection, key: key}], nil
+}
+
+func (s *MemoryStub) GetPrivateDataByRange(collection, startKey, endKey string) (shim.StateQueryIteratorInterface, error) {
+	if collection == "" {
+		return nil, fmt.Errorf("collection must not be an empty string")
+	}
+	if err := validateSimpleKeys(startKey, endKey); err != nil {
+		return nil, err
+	}
+	if startKey == "" {
+		startKey = "\x01"
+	}
+	return &memoryIterator{results: s.scan(collection, startKey, endKey)}, nil
+}
+
+func (s *MemoryStub) GetPrivateDataByPartialCompositeKey(collection, objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	if collection == "" {
+		return nil, fmt.Errorf("collection must not be an empty string")
+	}
+	startKey, endKey, err := partialKeyRange(objectType, keys)
+	if err != nil {
+		return nil, err
+	}
+	return &memoryIterator{results: s.scan(collection, startKey, endKey)}, nil
+}
+
+func (s *MemoryStub) GetPrivateDataQueryResult(collection, query string) (shim.StateQueryIteratorInterface, error) {
+	return nil, fmt.Errorf("ExecuteQuery not supported for leveldb")
+}
+
+func (s *MemoryStub) GetCreator() ([]byte, error) {
+	return s.Creator, nil
+}
+
+func (s *MemoryStub) GetTransient() (map[string][]byte, error) {
+	if s.Transient == nil {
+		return map[string][]byte{}, nil
+	}
+	return s.Transient, nil
+}
+
+func (s *MemoryStub) GetBinding() ([]byte, error) {
+	return nil, nil
+}
+
+func (s *MemoryStub) GetDecorations() map[string][]byte {
+	return nil
+}
+
+func (s *MemoryStub) GetSignedProposal() (*peer.SignedProposal, error) {
+	return nil, fmt.Errorf("GetSignedProposal is not supported by MemoryStub")
+}
+
+func (s *MemoryStub) GetTxTimestamp() (*timestamppb.Timestamp, error) {
+	return timestamppb.New(s.Timestamp), nil
+}
+
+func (s *MemoryStub) SetEvent(name string, payload []byte) error {
+	if name == "" {
+		return fmt.Errorf("event name can not be empty string")
+	}
+	s.event = &peer.ChaincodeEvent{
+		ChaincodeId: "basic",
+		TxId:        s.TxID,
+		EventName:   name,
+		Payload:     payload,
+	}
+	return nil
+}
+
+// read returns the committed value of a key; writes of the current
+// transaction are not visible
+func (s *MemoryStub) read(collection, key string) ([]byte, error) {
+	value, ok := s.state[stateKey{collection: collection, key: key}]
+	if !ok {
+		return nil, nil
+	}
+	return append([]byte{}, value...), nil
+}
+
+func (s *MemoryStub) write(collection, key string, value []byte, isDelete bool) error {
+	if key == "" {
+		return fmt.Errorf("key must not be an empty string")
+	}
+	if !utf8.ValidString(key) {
+		return fmt.Errorf("key %x is not a valid utf8 string", key)
+	}
+	if !isDelete {
+		value = append([]byte{}, value...)
+	}
+	s.writes[stateKey{collection: collection, key: key}] = &stateWrite{value: value, isDelete: isDelete}
+	return nil
+}
+
+// scan returns the committed entries with startKey <= key < endKey in key
+// order. An empty endKey leaves the range open.
+func (s *MemoryStub) scan(collection, startKey, endKey string) []*queryresult.KV {
+	var results []*queryresult.KV
+	for key, value := range s.state {
+		if key.collection != collection || key.key < startKey || (endKey != "" && key.key >= endKey) {
+			continue
+		}
+		results = append(results, &queryresult.KV{
+			Namespace: "basic",
+			Key:       key.key,
+			Value:     append([]byte{}, value...),
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Key < results[j].Key
+	})
+	return results
+}
+
+// page returns up to pageSize entries of a range starting at bookmark, which
+// is the key of the first entry of the page
+func (s *MemoryStub) page(collection, startKey, endKey string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	if bookmark != "" {
+		if bookmark < startKey || (endKey != "" && bookmark >= endKey) {
+			return nil, nil, fmt.Errorf("invalid bookmark %q", bookmark)
+		}
+		startKey = bookmark
+	}
+
+	results := s.scan(collection, startKey, endKey)
+	next := ""
+	if pageSize > 0 && int(pageSize) < len(results) {
+		next = results[pageSize].Key
+		results = results[:pageSize]
+	}
+
+	return &memoryIterator{results: results}, &peer.QueryResponseMetadata{
+		FetchedRecordsCount: int32(len(results)),
+		Bookmark:            next,
+	}, nil
+}
+
+func partialKeyRange(objectType string, keys []string) (string, string, error) {
+	partialKey, err := shim.CreateCompositeKey(objectType, keys)
+	if err != nil {
+		return "", "", err
+	}
+	return partialKey, partialKey + string(utf8.MaxRune), nil
+}
+
+func validateSimpleKeys(keys ...string) error {
+	for _, key := range keys {
+		if strings.HasPrefix(key, "\x00") {
+			return fmt.Errorf("first character of the key [%s] contains a null character which is not allowed", key)
+		}
+	}
+	return nil
+}
+
+// memoryIterator iterates over a snapshot of range query results
+type memoryIterator struct {
+	results []*queryresult.KV
+	next    int
+}
+
+func (it *memoryIterator) HasNext() bool {
+	return it.next < len(it.results)
+}
+
+func (it *memoryIterator) Next() (*queryresult.KV, error) {
+	if !it.HasNext() {
+		return nil, fmt.Errorf("no more results")
+	}
+	it.next++
+	return it.results[it.next-1], nil
+}
+
+func (it *memoryIterator) Close() error {
+	return nil
+}
+
+// historyIterator iterates over a snapshot of key history
+type historyIterator struct {
+	results []*queryresult.KeyModification
+	next    int
+}
+
+func (it *historyIterator) HasNext() bool {
+	return it.next < len(it.results)
+}
+
+func (it *historyIterator) Next() (*queryresult.KeyModification, error) {
+	if !it.HasNext() {
+		return nil, fmt.Errorf("no more results")
+	}
+	it.next++
+	return it.results[it.next-1], nil
+}
+
+func (it *historyIterator) Close() error {
+	return nil
+}
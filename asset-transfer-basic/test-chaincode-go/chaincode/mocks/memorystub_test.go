@@ -0,0 +1,161 @@
+package mocks_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+// keys drains a range query iterator
+func keys(t *testing.T, iterator shim.StateQueryIteratorInterface) []string {
+	t.Helper()
+	defer iterator.Close()
+
+	var keys []string
+	for iterator.HasNext() {
+		kv, err := iterator.Next()
+		require.NoError(t, err)
+		keys = append(keys, kv.Key)
+	}
+	return keys
+}
+
+func TestMemoryStubTransactions(t *testing.T) {
+	stub := mocks.NewMemoryStub()
+
+	stub.Begin("tx1")
+	require.NoError(t, stub.PutState("A", []byte("1")))
+	require.NoError(t, stub.SetEvent("Written", []byte("A")))
+	value, err := stub.GetState("A")
+	require.NoError(t, err)
+	require.Nil(t, value, "writes must not be visible to their own transaction")
+	stub.Commit()
+
+	value, err = stub.GetState("A")
+	require.NoError(t, err)
+	require.Equal(t, []byte("1"), value)
+	require.Equal(t, "Written", stub.LastEvent().EventName)
+	require.Equal(t, "tx1", stub.LastEvent().TxId)
+
+	stub.Begin("tx2")
+	require.NoError(t, stub.PutState("B", []byte("2")))
+	require.NoError(t, stub.DelState("A"))
+	require.NoError(t, stub.SetEvent("Dropped", nil))
+	stub.Transient = map[string][]byte{"key": []byte("secret")}
+	stub.Rollback()
+
+	require.Equal(t, []string{"A"}, stub.Keys())
+	require.Len(t, stub.Events, 1)
+	require.Nil(t, stub.Transient)
+
+	stub.Begin("tx3")
+	require.EqualError(t, stub.PutState("", nil), "key must not be an empty string")
+	require.EqualError(t, stub.SetEvent("", nil), "event name can not be empty string")
+	stub.Rollback()
+}
+
+func TestMemoryStubRangeQueries(t *testing.T) {
+	stub := mocks.NewMemoryStub()
+	for _, key := range []string{"D3", "D1", "D2", "E1"} {
+		stub.PutCommittedState(key, []byte(key))
+	}
+	first, err := stub.CreateCompositeKey("status~id", []string{"active", "D1"})
+	require.NoError(t, err)
+	second, err := stub.CreateCompositeKey("status~id", []string{"active", "D2"})
+	require.NoError(t, err)
+	other, err := stub.CreateCompositeKey("status~id", []string{"revoked", "D3"})
+	require.NoError(t, err)
+	stub.PutCommittedState(second, []byte{0})
+	stub.PutCommittedState(first, []byte{0})
+	stub.PutCommittedState(other, []byte{0})
+
+	iterator, err := stub.GetStateByRange("", "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"D1", "D2", "D3", "E1"}, keys(t, iterator), "composite keys must stay out of simple ranges")
+	iterator, err = stub.GetStateByRange("D2", "E")
+	require.NoError(t, err)
+	require.Equal(t, []string{"D2", "D3"}, keys(t, iterator))
+	_, err = stub.GetStateByRange(first, "")
+	require.Error(t, err)
+
+	iterator, metadata, err := stub.GetStateByRangeWithPagination("", "", 3, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"D1", "D2", "D3"}, keys(t, iterator))
+	require.Equal(t, int32(3), metadata.FetchedRecordsCount)
+	require.Equal(t, "E1", metadata.Bookmark)
+	iterator, metadata, err = stub.GetStateByRangeWithPagination("", "", 3, metadata.Bookmark)
+	require.NoError(t, err)
+	require.Equal(t, []string{"E1"}, keys(t, iterator))
+	require.Empty(t, metadata.Bookmark)
+	_, _, err = stub.GetStateByRangeWithPagination("D", "E", 3, "E1")
+	require.EqualError(t, err, `invalid bookmark "E1"`)
+
+	iterator, err = stub.GetStateByPartialCompositeKey("status~id", []string{"active"})
+	require.NoError(t, err)
+	require.Equal(t, []string{first, second}, keys(t, iterator))
+	objectType, attributes, err := stub.SplitCompositeKey(second)
+	require.NoError(t, err)
+	require.Equal(t, "status~id", objectType)
+	require.Equal(t, []string{"active", "D2"}, attributes)
+
+	iterator, metadata, err = stub.GetStateByPartialCompositeKeyWithPagination("status~id", nil, 2, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{first, second}, keys(t, iterator))
+	require.Equal(t, other, metadata.Bookmark)
+
+	_, err = stub.GetQueryResult(`{"selector":{}}`)
+	require.Error(t, err)
+}
+
+func TestMemoryStubHistory(t *testing.T) {
+	stub := mocks.NewMemoryStub()
+	stub.Begin("tx1")
+	require.NoError(t, stub.PutState("D1", []byte("v1")))
+	stub.Commit()
+	stub.Begin("tx2")
+	require.NoError(t, stub.DelState("D1"))
+	stub.Commit()
+
+	iterator, err := stub.GetHistoryForKey("D1")
+	require.NoError(t, err)
+	defer iterator.Close()
+
+	var txIDs []string
+	for iterator.HasNext() {
+		modification, err := iterator.Next()
+		require.NoError(t, err)
+		txIDs = append(txIDs, modification.TxId)
+		require.Equal(t, modification.TxId == "tx2", modification.IsDelete)
+	}
+	require.Equal(t, []string{"tx2", "tx1"}, txIDs)
+	_, err = iterator.Next()
+	require.Error(t, err)
+}
+
+func TestMemoryStubPrivateData(t *testing.T) {
+	stub := mocks.NewMemoryStub()
+	stub.Begin("tx1")
+	require.NoError(t, stub.PutPrivateData("keys", "D1", []byte("secret")))
+	stub.Commit()
+
+	value, err := stub.GetPrivateData("keys", "D1")
+	require.NoError(t, err)
+	require.Equal(t, []byte("secret"), value)
+	hash, err := stub.GetPrivateDataHash("keys", "D1")
+	require.NoError(t, err)
+	require.Len(t, hash, 32)
+	require.Empty(t, stub.Keys(), "private data must stay out of the world state")
+
+	iterator, err := stub.GetPrivateDataByRange("keys", "", "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"D1"}, keys(t, iterator))
+
+	stub.Begin("tx2")
+	require.NoError(t, stub.DelPrivateData("keys", "D1"))
+	stub.Commit()
+	value, err = stub.GetPrivateData("keys", "D1")
+	require.NoError(t, err)
+	require.Nil(t, value)
+}
@@ -0,0 +1,93 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// deviceNamespace is the composite key object type of the device records.
+// Keeping devices under their own prefix lets the device queries scan them
+// without picking up any other record of the chaincode.
+const deviceNamespace = "device"
+
+// deviceStateKey returns the world state key of a device
+func deviceStateKey(ctx contractapi.TransactionContextInterface, id string) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(deviceNamespace, []string{id})
+	if err != nil {
+		return "", fmt.Errorf("failed to create device key: %v", err)
+	}
+	return key, nil
+}
+
+// deviceIterator scans every device record
+func deviceIterator(ctx contractapi.TransactionContextInterface) (shim.StateQueryIteratorInterface, error) {
+	return ctx.GetStub().GetStateByPartialCompositeKey(deviceNamespace, []string{})
+}
+
+// MigrateDeviceNamespace moves the device records written under their bare
+// ID into the device namespace and returns how many were moved. Records are
+// copied unchanged together with their endorsement policy, so the other
+// migrations may run before or after this one.
+func (s *SmartContract) MigrateDeviceNamespace(ctx contractapi.TransactionContextInterface) (int, error) {
+	if err := s.authorizeWrite(ctx); err != nil {
+		return 0, err
+	}
+
+	return migrateDeviceNamespace(ctx)
+}
+
+func migrateDeviceNamespace(ctx contractapi.TransactionContextInterface) (int, error) {
+	// range query with empty string for startKey and endKey does an
+	// open-ended query of the simple keys, which only devices ever used
+	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
+	if err != nil {
+		return 0, err
+	}
+	defer resultsIterator.Close()
+
+	count := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return 0, err
+		}
+
+		var asset Asset
+		if err := json.Unmarshal(queryResponse.Value, &asset); err != nil || asset.ID != queryResponse.Key {
+			return 0, fmt.Errorf("the record under key %q is not a device and cannot be migrated", queryResponse.Key)
+		}
+		key, err := deviceStateKey(ctx, asset.ID)
+		if err != nil {
+			return 0, err
+		}
+		existing, err := ctx.GetStub().GetState(key)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read from world state: %v", err)
+		}
+		if existing != nil {
+			return 0, fmt.Errorf("the device %s is stored both under its bare ID and in the device namespace", asset.ID)
+		}
+
+		policy, err := ctx.GetStub().GetStateValidationParameter(asset.ID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read endorsement policy of device %s: %v", asset.ID, err)
+		}
+		if err := ctx.GetStub().PutState(key, queryResponse.Value); err != nil {
+			return 0, fmt.Errorf("failed to put to world state. %v", err)
+		}
+		if len(policy) > 0 {
+			if err := ctx.GetStub().SetStateValidationParameter(key, policy); err != nil {
+				return 0, fmt.Errorf("failed to set endorsement policy of device %s: %v", asset.ID, err)
+			}
+		}
+		if err := ctx.GetStub().DelState(asset.ID); err != nil {
+			return 0, fmt.Errorf("failed to delete from world state: %v", err)
+		}
+		count++
+	}
+
+	return count, nil
+}
@@ -0,0 +1,51 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateDeviceNamespace(t *testing.T) {
+	l := newLedger(t)
+	l.stub.PutCommittedState("D0", []byte(`{"ID":"D0","Status":"active","KeyType":"AES","KeyVersion":1}`))
+	l.register("D1")
+
+	migrate := func() (int, error) {
+		var count int
+		err := l.submit(func(ctx contractapi.TransactionContextInterface) error {
+			var err error
+			count, err = l.contract.MigrateDeviceNamespace(ctx)
+			return err
+		})
+		return count, err
+	}
+	count, err := migrate()
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+	require.Equal(t, "active", l.asset("D0").Status)
+	value, err := l.stub.GetState("D0")
+	require.NoError(t, err)
+	require.Nil(t, value)
+	require.Len(t, l.getAll(), 2)
+
+	count, err = migrate()
+	require.NoError(t, err)
+	require.Zero(t, count)
+
+	l.stub.PutCommittedState("D1", []byte(`{"ID":"D1","Status":"active"}`))
+	_, err = migrate()
+	require.EqualError(t, err, "the device D1 is stored both under its bare ID and in the device namespace")
+
+	l.stub.PutCommittedState("D1", []byte(`{"ID":"D2"}`))
+	_, err = migrate()
+	require.EqualError(t, err, `the record under key "D1" is not a device and cannot be migrated`)
+}
+
+func TestInitLedgerMigratesNamespace(t *testing.T) {
+	l := newLedger(t)
+	l.stub.PutCommittedState("D0", []byte(`{"ID":"D0","Status":"active","KeyType":"AES","KeyVersion":1}`))
+	require.NoError(t, l.submit(l.contract.InitLedger))
+	require.NotNil(t, l.asset("D0"))
+}
@@ -0,0 +1,322 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Device AES keys are kept in the implicit private data collection of the
+// organization owning the device, so only the peers of that organization
+// store them and they never reach public world state. Implicit collections
+// need no collection configuration.
+const implicitCollectionPrefix = "_implicit_org_"
+
+// sharedKeyCollection is the collection of collections_config.json that
+// earlier versions kept the keys of every organization in. It still holds
+// the keys of devices registered before owners were recorded.
+const sharedKeyCollection = "deviceKeyCollection"
+
+// transientKeyField is the transient map entry that carries a device key
+const transientKeyField = "key"
+
+// deviceKey is the private data record of a device key. After a rotation
+// with a grace window the previous key is kept until PreviousValidUntil.
+type deviceKey struct {
+	ID                 string    `json:"ID"`
+	Key                string    `json:"Key"`
+	Version            int       `json:"Version"`
+	PreviousKey        string    `json:"PreviousKey,omitempty"`
+	PreviousValidUntil time.Time `json:"PreviousValidUntil,omitempty"`
+}
+
+// DeviceCredential is what Auth hands to the gateway to verify a device.
+// AES devices get Key, and PreviousKey while the grace window of the last
+// rotation is open. ECDSA and Ed25519 devices get PublicKey.
+type DeviceCredential struct {
+	ID                    string `json:"ID"`
+	Status                string `json:"Status"`
+	Key                   string `json:"Key,omitempty" metadata:",optional"`
+	KeyType               string `json:"KeyType,omitempty" metadata:",optional"`
+	KeyVersion            int    `json:"KeyVersion"`
+	PublicKey             string `json:"PublicKey,omitempty" metadata:",optional"`
+	PreviousKey           string `json:"PreviousKey,omitempty" metadata:",optional"`
+	PreviousKeyValidUntil string `json:"PreviousKeyValidUntil,omitempty" metadata:",optional"`
+}
+
+// RotateKey replaces the key of an AES device with the one passed in the
+// transient map and bumps its key version. For graceSeconds after the
+// rotation Auth still returns the previous key so that devices can be
+// re-flashed without downtime; zero drops the previous key at once.
+func (s *SmartContract) RotateKey(ctx contractapi.TransactionContextInterface, id string, graceSeconds int) error {
+	if err := s.authorizeWrite(ctx); err != nil {
+		return err
+	}
+
+	if graceSeconds < 0 {
+		return fmt.Errorf("grace window must not be negative, got %d", graceSeconds)
+	}
+	key, err := transientKey(ctx)
+	if err != nil {
+		return err
+	}
+
+	asset, err := s.readDevice(ctx, id)
+	if err != nil {
+		return err
+	}
+	status := storedStatus(asset.Status)
+	if status == StatusDecommissioned {
+		return fmt.Errorf("the device %s is %s and its key cannot be rotated", id, status)
+	}
+	if asset.keyType() != KeyTypeAES {
+		return fmt.Errorf("the device %s uses %s credentials, only AES keys can be rotated", id, asset.KeyType)
+	}
+
+	record, err := readDeviceKey(ctx, asset)
+	if err != nil {
+		return err
+	}
+	if key == record.Key {
+		return fmt.Errorf("the new key of device %s must differ from the current one", id)
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	rotated := deviceKey{ID: id, Key: key, Version: record.Version + 1}
+	if graceSeconds > 0 {
+		rotated.PreviousKey = record.Key
+		rotated.PreviousValidUntil = now.Add(time.Duration(graceSeconds) * time.Second)
+	}
+	if err := putDeviceKey(ctx, asset.OwnerMSP, &rotated); err != nil {
+		return err
+	}
+	// the organization a transfer is pending to receives the new key too
+	transfer, err := readTransfer(ctx, id)
+	if err != nil {
+		return err
+	}
+	if transfer != nil {
+		if err := putDeviceKey(ctx, transfer.ToMSP, &rotated); err != nil {
+			return err
+		}
+	}
+
+	updatedBy, err := invokerID(ctx)
+	if err != nil {
+		return err
+	}
+	asset.KeyVersion = rotated.Version
+	asset.UpdatedBy = updatedBy
+	if err := s.putDevice(ctx, asset); err != nil {
+		return err
+	}
+
+	return emitDeviceEvent(ctx, EventDeviceKeyRotated, id, status, status)
+}
+
+// credential builds the Auth result from the stored key of a device
+func (record *deviceKey) credential(asset *Asset, now time.Time) *DeviceCredential {
+	credential := &DeviceCredential{
+		ID:         asset.ID,
+		Status:     asset.Status,
+		Key:        record.Key,
+		KeyType:    KeyTypeAES,
+		KeyVersion: record.Version,
+	}
+	if record.PreviousKey != "" && now.Before(record.PreviousValidUntil) {
+		credential.PreviousKey = record.PreviousKey
+		credential.PreviousKeyValidUntil = record.PreviousValidUntil.Format(time.RFC3339)
+	}
+	return credential
+}
+
+// legacyAsset is a device record written while keys lived in world state
+type legacyAsset struct {
+	Asset
+	Key string `json:"Key"`
+}
+
+// MigrateDeviceKeys moves keys left in public device records into the
+// private collection of their owner and rewrites those records without
+// them. Devices without an owner become owned by the organization of the
+// invoking client, so that no key lands in the shared collection every
+// organization reads. Keys of owned devices still in the shared collection
+// move to the collection of their owner. It returns the number of devices migrated.
+// Earlier blocks still hold the keys moved out of public records, so those
+// devices should also be given new keys.
+func (s *SmartContract) MigrateDeviceKeys(ctx contractapi.TransactionContextInterface) (int, error) {
+	if err := s.authorizeWrite(ctx); err != nil {
+		return 0, err
+	}
+
+	resultsIterator, err := deviceIterator(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer resultsIterator.Close()
+
+	mspID, err := invokerMSP(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return 0, err
+		}
+
+		var legacy legacyAsset
+		err = json.Unmarshal(queryResponse.Value, &legacy)
+		if err != nil {
+			return 0, err
+		}
+		if legacy.Key == "" {
+			moved, err := moveSharedKey(ctx, &legacy.Asset)
+			if err != nil {
+				return 0, err
+			}
+			if moved {
+				count++
+			}
+			continue
+		}
+
+		if legacy.OwnerMSP == "" {
+			legacy.OwnerMSP = mspID
+		}
+		if err := putDeviceKey(ctx, legacy.OwnerMSP, &deviceKey{ID: legacy.ID, Key: legacy.Key, Version: 1}); err != nil {
+			return 0, err
+		}
+		legacy.Asset.KeyType = KeyTypeAES
+		legacy.Asset.KeyVersion = 1
+		if err := s.putDevice(ctx, &legacy.Asset); err != nil {
+			return 0, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// transientKey reads the device key from the transient map of the proposal
+func transientKey(ctx contractapi.TransactionContextInterface) (string, error) {
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return "", fmt.Errorf("failed to read transient map: %v", err)
+	}
+
+	key, ok := transientMap[transientKeyField]
+	if !ok || len(key) == 0 {
+		return "", fmt.Errorf("the device key must be passed in the transient map under %q", transientKeyField)
+	}
+	if err := validateAESKey(string(key)); err != nil {
+		return "", err
+	}
+
+	return string(key), nil
+}
+
+// validateAESKey checks that a device key has a valid AES key size
+func validateAESKey(key string) error {
+	if n := len(key); n != 16 && n != 24 && n != 32 {
+		return fmt.Errorf("the device key must be 16, 24 or 32 bytes long, got %d", n)
+	}
+	return nil
+}
+
+// moveSharedKey moves the key of an owned AES device from the shared
+// collection to the collection of its owner, unless the owner already holds
+// it. The hash tells whether the owner holds a key on any peer.
+func moveSharedKey(ctx contractapi.TransactionContextInterface, asset *Asset) (bool, error) {
+	if asset.OwnerMSP == "" || asset.keyType() != KeyTypeAES {
+		return false, nil
+	}
+	collection := keyCollection(asset.OwnerMSP)
+	hash, err := ctx.GetStub().GetPrivateDataHash(collection, asset.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to read device key hash from %s: %v", collection, err)
+	}
+	if hash != nil {
+		return false, nil
+	}
+
+	keyJSON, err := ctx.GetStub().GetPrivateData(sharedKeyCollection, asset.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to read device key from %s: %v", sharedKeyCollection, err)
+	}
+	if keyJSON == nil {
+		return false, nil
+	}
+	if err := ctx.GetStub().PutPrivateData(collection, asset.ID, keyJSON); err != nil {
+		return false, fmt.Errorf("failed to put device key to %s: %v", collection, err)
+	}
+	if err := ctx.GetStub().DelPrivateData(sharedKeyCollection, asset.ID); err != nil {
+		return false, fmt.Errorf("failed to delete device key from %s: %v", sharedKeyCollection, err)
+	}
+	return true, nil
+}
+
+// keyCollection returns the collection holding the keys of the devices
+// owned by ownerMSP
+func keyCollection(ownerMSP string) string {
+	if ownerMSP == "" {
+		return sharedKeyCollection
+	}
+	return implicitCollectionPrefix + ownerMSP
+}
+
+// putDeviceKey stores the key of a device in the collection of ownerMSP
+func putDeviceKey(ctx contractapi.TransactionContextInterface, ownerMSP string, record *deviceKey) error {
+	keyJSON, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	collection := keyCollection(ownerMSP)
+	if err := ctx.GetStub().PutPrivateData(collection, record.ID, keyJSON); err != nil {
+		return fmt.Errorf("failed to put device key to %s: %v", collection, err)
+	}
+	return nil
+}
+
+// delDeviceKey removes the key of a device from the collection of ownerMSP
+func delDeviceKey(ctx contractapi.TransactionContextInterface, ownerMSP string, id string) error {
+	collection := keyCollection(ownerMSP)
+	if err := ctx.GetStub().DelPrivateData(collection, id); err != nil {
+		return fmt.Errorf("failed to delete device key from %s: %v", collection, err)
+	}
+	return nil
+}
+
+// readDeviceKey returns the key record of a device from the collection of
+// its owner. Only the peers of the owner hold it, so the transaction must
+// be endorsed by one of them.
+func readDeviceKey(ctx contractapi.TransactionContextInterface, asset *Asset) (*deviceKey, error) {
+	id := asset.ID
+	collection := keyCollection(asset.OwnerMSP)
+	keyJSON, err := ctx.GetStub().GetPrivateData(collection, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read device key from %s: %v", collection, err)
+	}
+	if keyJSON == nil {
+		return nil, fmt.Errorf("no key is registered for device %s", id)
+	}
+
+	var record deviceKey
+	err = json.Unmarshal(keyJSON, &record)
+	if err != nil {
+		return nil, err
+	}
+	if record.Version == 0 {
+		record.Version = 1
+	}
+
+	return &record, nil
+}
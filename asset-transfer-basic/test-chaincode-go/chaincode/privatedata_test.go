@@ -0,0 +1,129 @@
+package chaincode_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+const rotatedKey = "fedcba9876543210"
+
+func (l *ledger) rotateKey(id string, key string, graceSeconds int) error {
+	l.stub.Transient = map[string][]byte{"key": []byte(key)}
+	return l.submit(func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.RotateKey(ctx, id, graceSeconds)
+	})
+}
+
+func TestRotateKey(t *testing.T) {
+	l := newLedger(t)
+	l.register("D1")
+
+	require.NoError(t, l.rotateKey("D1", rotatedKey, 60))
+	require.Equal(t, 2, l.asset("D1").KeyVersion)
+	require.Equal(t, chaincode.EventDeviceKeyRotated, l.lastEvent().Event)
+
+	credential, err := l.auth("D1")
+	require.NoError(t, err)
+	require.Equal(t, rotatedKey, credential.Key)
+	require.Equal(t, 2, credential.KeyVersion)
+	require.Equal(t, testKey, credential.PreviousKey)
+	require.Equal(t, "2024-01-01T00:01:02Z", credential.PreviousKeyValidUntil)
+
+	// the previous key is dropped once the grace window is over
+	l.stub.Timestamp = l.stub.Timestamp.Add(time.Minute)
+	credential, err = l.auth("D1")
+	require.NoError(t, err)
+	require.Empty(t, credential.PreviousKey)
+
+	require.EqualError(t, l.rotateKey("D1", rotatedKey, 0), "the new key of device D1 must differ from the current one")
+	require.EqualError(t, l.rotateKey("D1", testKey, -1), "grace window must not be negative, got -1")
+	require.EqualError(t, l.rotateKey("D2", testKey, 0), "the device D2 does not exist")
+
+	require.NoError(t, l.rotateKey("D1", testKey, 0))
+	credential, err = l.auth("D1")
+	require.NoError(t, err)
+	require.Equal(t, 3, credential.KeyVersion)
+	require.Empty(t, credential.PreviousKey)
+
+	l.update("D1", chaincode.StatusDecommissioned)
+	require.EqualError(t, l.rotateKey("D1", rotatedKey, 0), "the device D1 is decommissioned and its key cannot be rotated")
+}
+
+func TestRotateKeyPendingTransfer(t *testing.T) {
+	l := newLedger(t)
+	l.configure(chaincode.Config{RequireTransferAcceptance: true})
+	l.register("D1")
+	require.NoError(t, l.transfer("D1", "Org2MSP"))
+
+	require.NoError(t, l.rotateKey("D1", rotatedKey, 0))
+	require.Contains(t, string(l.deviceKey("Org1MSP", "D1")), rotatedKey)
+	require.Contains(t, string(l.deviceKey("Org2MSP", "D1")), rotatedKey)
+}
+
+func TestMigrateDeviceKeys(t *testing.T) {
+	l := newLedger(t)
+	key, err := l.stub.CreateCompositeKey("device", []string{"D0"})
+	require.NoError(t, err)
+	l.stub.PutCommittedState(key, []byte(`{"ID":"D0","Status":"active","Key":"0123456789abcdef"}`))
+	l.register("D1")
+
+	var count int
+	require.NoError(t, l.submit(func(ctx contractapi.TransactionContextInterface) error {
+		count, err = l.contract.MigrateDeviceKeys(ctx)
+		return err
+	}))
+	require.Equal(t, 1, count)
+
+	assetJSON, err := l.stub.GetState(key)
+	require.NoError(t, err)
+	require.NotContains(t, string(assetJSON), testKey)
+	// the owner-less device now belongs to the organization that migrated it
+	require.Equal(t, "Org1MSP", l.asset("D0").OwnerMSP)
+	require.Contains(t, string(l.deviceKey("Org1MSP", "D0")), testKey)
+	shared, err := l.stub.GetPrivateData("deviceKeyCollection", "D0")
+	require.NoError(t, err)
+	require.Nil(t, shared)
+	credential, err := l.auth("D0")
+	require.NoError(t, err)
+	require.Equal(t, testKey, credential.Key)
+	_, err = l.authAs(org2Gateway, "D0")
+	require.EqualError(t, err, "access denied: the device D0 is owned by Org1MSP")
+
+	require.NoError(t, l.submit(func(ctx contractapi.TransactionContextInterface) error {
+		count, err = l.contract.MigrateDeviceKeys(ctx)
+		return err
+	}))
+	require.Zero(t, count)
+}
+
+func TestMigrateSharedDeviceKeys(t *testing.T) {
+	l := newLedger(t)
+	l.register("D1")
+	// D1 was registered while all keys lived in the shared collection
+	keyJSON := l.deviceKey("Org1MSP", "D1")
+	require.NoError(t, l.submit(func(ctx contractapi.TransactionContextInterface) error {
+		if err := ctx.GetStub().DelPrivateData("_implicit_org_Org1MSP", "D1"); err != nil {
+			return err
+		}
+		return ctx.GetStub().PutPrivateData("deviceKeyCollection", "D1", keyJSON)
+	}))
+	_, err := l.auth("D1")
+	require.EqualError(t, err, "no key is registered for device D1")
+
+	var count int
+	require.NoError(t, l.submit(func(ctx contractapi.TransactionContextInterface) error {
+		count, err = l.contract.MigrateDeviceKeys(ctx)
+		return err
+	}))
+	require.Equal(t, 1, count)
+	key, err := l.stub.GetPrivateData("deviceKeyCollection", "D1")
+	require.NoError(t, err)
+	require.Nil(t, key)
+	credential, err := l.auth("D1")
+	require.NoError(t, err)
+	require.Equal(t, testKey, credential.Key)
+}
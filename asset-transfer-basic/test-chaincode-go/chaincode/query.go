@@ -0,0 +1,193 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// deviceDocType marks device records so that rich queries skip every other
+// JSON document in the namespace
+const deviceDocType = "device"
+
+// queryIndexes are the CouchDB indexes shipped in META-INF for the fields
+// device selectors filter on, most selective first. Each covers DocType,
+// which every query adds, followed by the field.
+var queryIndexes = []struct {
+	field string
+	name  string
+}{
+	{"Owner", "indexOwner"},
+	{"Site", "indexSite"},
+	{"Model", "indexModel"},
+	{"Tags", "indexTags"},
+	{"OwnerMSP", "indexOwnerMSP"},
+	{"SchemaVersion", "indexSchemaVersion"},
+	{"Status", "indexStatus"},
+}
+
+// DevicePage is one page of devices together with the bookmark of the next page
+type DevicePage struct {
+	Devices             []*Device_list `json:"Devices"`
+	FetchedRecordsCount int32          `json:"FetchedRecordsCount"`
+	Bookmark            string         `json:"Bookmark"`
+}
+
+// GetAllPaginated returns up to pageSize devices starting at bookmark. An
+// empty bookmark starts at the first device and an empty Bookmark in the
+// result means there are no more pages. Deleted devices are dropped from the
+// page, so a page may hold fewer than pageSize devices while
+// FetchedRecordsCount still counts every record read. When status is set the
+// pages run over the status~id index instead, which only lists the devices in
+// that status, and a bookmark is only valid for the status it was returned
+// for. Pages of active devices end with the devices whose suspension ended.
+func (s *SmartContract) GetAllPaginated(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string, status string) (*DevicePage, error) {
+	if err := s.authorizeRead(ctx); err != nil {
+		return nil, err
+	}
+
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("page size must be positive, got %d", pageSize)
+	}
+	if status != "" {
+		var err error
+		if status, err = parseStatus(status); err != nil {
+			return nil, err
+		}
+		return statusPage(ctx, status, pageSize, bookmark)
+	}
+
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(deviceNamespace, []string{}, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	devices, err := collectDevices(ctx, resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+	if devices == nil {
+		devices = []*Device_list{}
+	}
+
+	return &DevicePage{
+		Devices:             devices,
+		FetchedRecordsCount: responseMetadata.FetchedRecordsCount,
+		Bookmark:            responseMetadata.Bookmark,
+	}, nil
+}
+
+// QueryDevices runs a CouchDB selector over the devices, for example
+// {"Status":"active"}, and returns one page of matches. The selector is
+// always restricted to device records, and the query uses the index of the
+// most selective indexed field the selector names. Peers backed by LevelDB
+// do not support rich queries and the transaction fails.
+func (s *SmartContract) QueryDevices(ctx contractapi.TransactionContextInterface, selector string, pageSize int32, bookmark string) (*DevicePage, error) {
+	if err := s.authorizeRead(ctx); err != nil {
+		return nil, err
+	}
+
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("page size must be positive, got %d", pageSize)
+	}
+
+	var conditions map[string]interface{}
+	if err := json.Unmarshal([]byte(selector), &conditions); err != nil || conditions == nil {
+		return nil, fmt.Errorf("selector must be a JSON object: %s", selector)
+	}
+	conditions["DocType"] = deviceDocType
+
+	query := map[string]interface{}{"selector": conditions}
+	for _, index := range queryIndexes {
+		if _, ok := conditions[index.field]; ok {
+			query["use_index"] = []string{"_design/" + index.name + "Doc", index.name}
+			break
+		}
+	}
+
+	queryJSON, err := json.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetQueryResultWithPagination(string(queryJSON), pageSize, bookmark)
+	if err != nil {
+		if strings.Contains(strings.ToLower(err.Error()), "not supported for leveldb") {
+			return nil, fmt.Errorf("QueryDevices requires peers with a CouchDB state database")
+		}
+		return nil, fmt.Errorf("failed to run rich query: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	devices, err := collectDevices(ctx, resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+	if devices == nil {
+		devices = []*Device_list{}
+	}
+
+	return &DevicePage{
+		Devices:             devices,
+		FetchedRecordsCount: responseMetadata.FetchedRecordsCount,
+		Bookmark:            responseMetadata.Bookmark,
+	}, nil
+}
+
+// collectDevices drains an iterator over device records, skipping deleted
+// devices and listing those whose suspension has ended as active
+func collectDevices(ctx contractapi.TransactionContextInterface, resultsIterator shim.StateQueryIteratorInterface) ([]*Device_list, error) {
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []*Device_list
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var asset Asset
+		err = json.Unmarshal(queryResponse.Value, &asset)
+		if err != nil {
+			return nil, err
+		}
+		if asset.deleted() {
+			continue
+		}
+		asset.endSuspension(now)
+		devices = append(devices, asset.listing())
+	}
+
+	return devices, nil
+}
+
+// listing returns the summary of the device returned by the device queries
+func (asset *Asset) listing() *Device_list {
+	schemaVersion := asset.SchemaVersion
+	if schemaVersion == 0 {
+		schemaVersion = 1
+	}
+	return &Device_list{
+		Firmware:         asset.Firmware,
+		ID:               asset.ID,
+		MAC:              asset.MAC,
+		Model:            asset.Model,
+		Owner:            asset.Owner,
+		OwnerMSP:         asset.OwnerMSP,
+		SchemaVersion:    schemaVersion,
+		Site:             asset.Site,
+		Status:           asset.Status,
+		SuspendedUntil:   asset.SuspendedUntil,
+		SuspensionReason: asset.SuspensionReason,
+		Tags:             asset.Tags,
+		ValidFrom:        asset.ValidFrom,
+		ValidUntil:       asset.ValidUntil,
+	}
+}
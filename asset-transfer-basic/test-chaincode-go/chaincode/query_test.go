@@ -0,0 +1,97 @@
+package chaincode_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetAllPaginated(t *testing.T) {
+	l := newLedger(t)
+	for i := 0; i < 5; i++ {
+		l.register(fmt.Sprintf("D%d", i))
+	}
+	l.update("D1", chaincode.StatusRevoked)
+	l.update("D3", chaincode.StatusRevoked)
+
+	getPage := func(pageSize int32, bookmark string, status string) (*chaincode.DevicePage, error) {
+		var page *chaincode.DevicePage
+		err := l.evaluate(func(ctx contractapi.TransactionContextInterface) error {
+			var err error
+			page, err = l.contract.GetAllPaginated(ctx, pageSize, bookmark, status)
+			return err
+		})
+		return page, err
+	}
+
+	var ids []string
+	bookmark := ""
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 3)
+		page, err := getPage(2, bookmark, "")
+		require.NoError(t, err)
+		for _, device := range page.Devices {
+			ids = append(ids, device.ID)
+		}
+		if bookmark = page.Bookmark; bookmark == "" {
+			break
+		}
+	}
+	require.Equal(t, []string{"D0", "D1", "D2", "D3", "D4"}, ids)
+
+	// pages of one status are full until the last
+	page, err := getPage(1, "", "Revoked")
+	require.NoError(t, err)
+	require.Equal(t, int32(1), page.FetchedRecordsCount)
+	require.Len(t, page.Devices, 1)
+	require.Equal(t, "D1", page.Devices[0].ID)
+	require.NotEmpty(t, page.Bookmark)
+	page, err = getPage(1, page.Bookmark, "Revoked")
+	require.NoError(t, err)
+	require.Len(t, page.Devices, 1)
+	require.Equal(t, "D3", page.Devices[0].ID)
+	require.Equal(t, chaincode.StatusRevoked, page.Devices[0].Status)
+	require.Empty(t, page.Bookmark)
+
+	page, err = getPage(3, "", "active")
+	require.NoError(t, err)
+	require.Equal(t, int32(3), page.FetchedRecordsCount)
+	require.Len(t, page.Devices, 3)
+	require.Equal(t, "D0", page.Devices[0].ID)
+
+	page, err = getPage(10, "", "pending")
+	require.NoError(t, err)
+	require.NotNil(t, page.Devices)
+	require.Empty(t, page.Devices)
+
+	_, err = getPage(0, "", "")
+	require.EqualError(t, err, "page size must be positive, got 0")
+	_, err = getPage(1, "", "lost")
+	require.Error(t, err)
+}
+
+func TestQueryDevices(t *testing.T) {
+	l := newLedger(t)
+	l.register("D1")
+
+	query := func(selector string) error {
+		return l.evaluate(func(ctx contractapi.TransactionContextInterface) error {
+			_, err := l.contract.QueryDevices(ctx, selector, 10, "")
+			return err
+		})
+	}
+	require.EqualError(t, query(`{"Status":"active"}`), "QueryDevices requires peers with a CouchDB state database")
+	require.JSONEq(t, `{"selector":{"DocType":"device","Status":"active"},"use_index":["_design/indexStatusDoc","indexStatus"]}`, l.stub.Queries[0])
+	require.Error(t, query(`{"Status":"active","Site":"lab","OwnerMSP":"Org1MSP"}`))
+	require.JSONEq(t, `{"selector":{"DocType":"device","Status":"active","Site":"lab","OwnerMSP":"Org1MSP"},"use_index":["_design/indexSiteDoc","indexSite"]}`, l.stub.Queries[1])
+	require.Error(t, query(`{"Firmware":"1.0"}`))
+	require.JSONEq(t, `{"selector":{"DocType":"device","Firmware":"1.0"}}`, l.stub.Queries[2])
+	require.EqualError(t, query(`["Status"]`), `selector must be a JSON object: ["Status"]`)
+	require.EqualError(t, l.evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		_, err := l.contract.QueryDevices(ctx, `{}`, 0, "")
+		return err
+	}), "page size must be positive, got 0")
+}
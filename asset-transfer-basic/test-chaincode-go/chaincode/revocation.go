@@ -0,0 +1,108 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// ReasonDeleted is the revocation reason of deleted devices. Revoked and
+// decommissioned devices carry their status as the reason.
+const ReasonDeleted = "deleted"
+
+// RevocationList lists every device that must no longer be accepted, as of
+// the transaction that produced it
+type RevocationList struct {
+	GeneratedAt string           `json:"GeneratedAt"`
+	Devices     []*RevokedDevice `json:"Devices"`
+}
+
+// RevokedDevice is one entry of the revocation list. KeyVersion is the last
+// key version issued to the device; Since is set for deleted devices.
+type RevokedDevice struct {
+	ID         string `json:"ID"`
+	Reason     string `json:"Reason"`
+	KeyVersion int    `json:"KeyVersion,omitempty" metadata:",optional"`
+	Reserved   bool   `json:"Reserved,omitempty" metadata:",optional"`
+	Since      string `json:"Since,omitempty" metadata:",optional"`
+}
+
+// GetRevocationList returns the revoked, decommissioned and deleted devices
+// ordered by ID, for brokers to refuse without asking the ledger each time
+func (s *SmartContract) GetRevocationList(ctx contractapi.TransactionContextInterface) (*RevocationList, error) {
+	if err := s.authorizeRead(ctx); err != nil {
+		return nil, err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resultsIterator, err := deviceIterator(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	revoked := []*RevokedDevice{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var asset Asset
+		err = json.Unmarshal(queryResponse.Value, &asset)
+		if err != nil {
+			return nil, err
+		}
+		if entry := asset.revocation(); entry != nil {
+			revoked = append(revoked, entry)
+		}
+	}
+
+	return &RevocationList{GeneratedAt: now.Format(time.RFC3339), Devices: revoked}, nil
+}
+
+// revocation returns the revocation list entry of the device, or nil if the
+// device may still be accepted
+func (asset *Asset) revocation() *RevokedDevice {
+	entry := RevokedDevice{ID: asset.ID, KeyVersion: asset.KeyVersion}
+	switch {
+	case asset.deleted():
+		entry.Reason = ReasonDeleted
+		entry.Reserved = asset.Reserved
+		entry.Since = asset.DeletedAt
+	case storedStatus(asset.Status) == StatusRevoked, storedStatus(asset.Status) == StatusDecommissioned:
+		entry.Reason = storedStatus(asset.Status)
+	default:
+		return nil
+	}
+	return &entry
+}
+
+// deleted reports whether the record is the tombstone of a deleted device
+func (asset *Asset) deleted() bool {
+	return asset.DeletedAt != ""
+}
+
+// checkRegistrable returns an error unless a new device may be registered
+// under id. The ID of a deleted device is free again unless it was reserved.
+func (s *SmartContract) checkRegistrable(ctx contractapi.TransactionContextInterface, id string) error {
+	asset, err := readRecord(ctx, id)
+	if err != nil {
+		return err
+	}
+	if asset == nil {
+		return nil
+	}
+	if !asset.deleted() {
+		return fmt.Errorf("the device %s already exists", id)
+	}
+	if asset.Reserved {
+		return fmt.Errorf("the device ID %s was reserved when the device was deleted and cannot be reused", id)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func (l *ledger) revocationList() *chaincode.RevocationList {
+	l.t.Helper()
+	var list *chaincode.RevocationList
+	require.NoError(l.t, l.evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		list, err = l.contract.GetRevocationList(ctx)
+		return err
+	}))
+	return list
+}
+
+func TestGetRevocationList(t *testing.T) {
+	l := newLedger(t)
+	require.Equal(t, &chaincode.RevocationList{GeneratedAt: "2024-01-01T00:00:00Z", Devices: []*chaincode.RevokedDevice{}}, l.revocationList())
+
+	for _, id := range []string{"D1", "D2", "D3", "D4", "D5"} {
+		l.register(id)
+	}
+	l.update("D1", chaincode.StatusRevoked)
+	l.update("D2", chaincode.StatusSuspended)
+	l.update("D3", chaincode.StatusDecommissioned)
+	require.NoError(t, l.delete("D4", true))
+
+	list := l.revocationList()
+	require.Equal(t, "2024-01-01T00:00:10Z", list.GeneratedAt)
+	require.Equal(t, []*chaincode.RevokedDevice{
+		{ID: "D1", Reason: chaincode.StatusRevoked, KeyVersion: 1},
+		{ID: "D3", Reason: chaincode.StatusDecommissioned, KeyVersion: 1},
+		{ID: "D4", Reason: chaincode.ReasonDeleted, KeyVersion: 1, Reserved: true, Since: "2024-01-01T00:00:10Z"},
+	}, list.Devices)
+
+	// deleted devices stay out of the device queries and the status index
+	require.Len(t, l.getAll(), 4)
+	require.Equal(t, []string{"D5"}, l.listByStatus(chaincode.StatusActive))
+}
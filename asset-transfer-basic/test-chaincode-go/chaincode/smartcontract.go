@@ -3,11 +3,14 @@ package chaincode
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
-// SmartContract provides functions for managing an Asset
+// SmartContract provides functions for managing an Asset. Its settings are
+// kept in the ledger, see Config.
 type SmartContract struct {
 	contractapi.Contract
 }
@@ -16,159 +19,395 @@ type SmartContract struct {
 // Insert struct field in alphabetic order => to achieve determinism across languages
 // golang keeps the order when marshal to json but doesn't order automatically
 type Asset struct {
-	ID     string `json:"ID"`
-	Status string `json:"Status"`
-	Key   string `json:"Key"`
+	DeletedAt        string   `json:"DeletedAt,omitempty" metadata:",optional"`
+	DocType          string   `json:"DocType,omitempty" metadata:",optional"`
+	Firmware         string   `json:"Firmware,omitempty" metadata:",optional"`
+	ID               string   `json:"ID"`
+	KeyType          string   `json:"KeyType,omitempty" metadata:",optional"`
+	KeyVersion       int      `json:"KeyVersion,omitempty" metadata:",optional"`
+	MAC              string   `json:"MAC,omitempty" metadata:",optional"`
+	Model            string   `json:"Model,omitempty" metadata:",optional"`
+	Owner            string   `json:"Owner,omitempty" metadata:",optional"`
+	OwnerMSP         string   `json:"OwnerMSP,omitempty" metadata:",optional"`
+	PublicKey        string   `json:"PublicKey,omitempty" metadata:",optional"`
+	Reserved         bool     `json:"Reserved,omitempty" metadata:",optional"`
+	SchemaVersion    int      `json:"SchemaVersion,omitempty" metadata:",optional"`
+	Site             string   `json:"Site,omitempty" metadata:",optional"`
+	Status           string   `json:"Status"`
+	SuspendedUntil   string   `json:"SuspendedUntil,omitempty" metadata:",optional"`
+	SuspensionReason string   `json:"SuspensionReason,omitempty" metadata:",optional"`
+	Tags             []string `json:"Tags,omitempty" metadata:",optional"`
+	UpdatedBy        string   `json:"UpdatedBy,omitempty" metadata:",optional"`
+	ValidFrom        string   `json:"ValidFrom,omitempty" metadata:",optional"`
+	ValidUntil       string   `json:"ValidUntil,omitempty" metadata:",optional"`
+
+	// suspensionEnded is set when a read found the suspension of the record
+	// over, so that the next write also moves its status index entry
+	suspensionEnded bool
 }
 type Device_list struct {
-	ID     string `json:"ID"`
-	Status string `json:"Status"`
+	Firmware         string   `json:"Firmware,omitempty" metadata:",optional"`
+	ID               string   `json:"ID"`
+	MAC              string   `json:"MAC,omitempty" metadata:",optional"`
+	Model            string   `json:"Model,omitempty" metadata:",optional"`
+	Owner            string   `json:"Owner,omitempty" metadata:",optional"`
+	OwnerMSP         string   `json:"OwnerMSP,omitempty" metadata:",optional"`
+	SchemaVersion    int      `json:"SchemaVersion,omitempty" metadata:",optional"`
+	Site             string   `json:"Site,omitempty" metadata:",optional"`
+	Status           string   `json:"Status"`
+	SuspendedUntil   string   `json:"SuspendedUntil,omitempty" metadata:",optional"`
+	SuspensionReason string   `json:"SuspensionReason,omitempty" metadata:",optional"`
+	Tags             []string `json:"Tags,omitempty" metadata:",optional"`
+	ValidFrom        string   `json:"ValidFrom,omitempty" metadata:",optional"`
+	ValidUntil       string   `json:"ValidUntil,omitempty" metadata:",optional"`
 }
 
-// InitLedger adds a base set of assets to the ledger
+// InitLedger prepares the ledger for this version of the contract. It seeds
+// no devices; ledgers written by earlier versions get their device records
+// moved into the device namespace.
 func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface) error {
-	assets := []Asset{
-		{ID: "D0", Status: "Admin", Key: "xyz"},
+	if err := s.authorizeWrite(ctx); err != nil {
+		return err
 	}
 
-	for _, asset := range assets {
-		assetJSON, err := json.Marshal(asset)
-		if err != nil {
+	_, err := migrateDeviceNamespace(ctx)
+	return err
+}
+
+// Register issues a new device to the world state with given details.
+// AES devices pass their key in the transient map and it is kept in the
+// implicit collection of the registering organization. ECDSA and Ed25519 devices pass a PEM encoded public
+// key instead, which is stored with the device record. metadataJSON is an
+// optional JSON object of DeviceMetadata fields. validFrom and validUntil
+// optionally bound the period in which the device may authenticate.
+func (s *SmartContract) Register(ctx contractapi.TransactionContextInterface, id string, status string, keyType string, publicKey string, metadataJSON string, validFrom string, validUntil string) error {
+	if err := s.authorizeWrite(ctx); err != nil {
+		return err
+	}
+
+	metadata, err := parseMetadata(DeviceMetadata{}, metadataJSON)
+	if err != nil {
+		return err
+	}
+	registration := DeviceRegistration{
+		DeviceMetadata: metadata,
+		DeviceValidity: DeviceValidity{ValidFrom: validFrom, ValidUntil: validUntil},
+		ID:             id,
+		Status:         status,
+		KeyType:        keyType,
+		PublicKey:      publicKey,
+	}
+	if err := registration.normalize(); err != nil {
+		return err
+	}
+	var key string
+	if registration.KeyType == KeyTypeAES {
+		if key, err = transientKey(ctx); err != nil {
 			return err
 		}
+	}
+
+	if err := s.checkRegistrable(ctx, id); err != nil {
+		return err
+	}
+	updatedBy, err := invokerID(ctx)
+	if err != nil {
+		return err
+	}
+	ownerMSP, err := invokerMSP(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := s.registerDevice(ctx, &registration, key, ownerMSP, updatedBy); err != nil {
+		return err
+	}
 
-		err = ctx.GetStub().PutState(asset.ID, assetJSON)
-		if err != nil {
-			return fmt.Errorf("failed to put to world state. %v", err)
+	return emitDeviceEvent(ctx, EventDeviceRegistered, id, "", registration.Status)
+}
+
+// registerDevice writes a validated registration to the ledger, owned by
+// ownerMSP. Only the peers of the owning organization may endorse later
+// changes to the device.
+func (s *SmartContract) registerDevice(ctx contractapi.TransactionContextInterface, registration *DeviceRegistration, key string, ownerMSP string, updatedBy string) error {
+	asset := Asset{
+		ID:         registration.ID,
+		KeyType:    registration.KeyType,
+		KeyVersion: 1,
+		OwnerMSP:   ownerMSP,
+		PublicKey:  registration.PublicKey,
+		Status:     registration.Status,
+		UpdatedBy:  updatedBy,
+	}
+	asset.setMetadata(registration.DeviceMetadata)
+	asset.setValidity(registration.DeviceValidity)
+	if err := s.putDevice(ctx, &asset); err != nil {
+		return err
+	}
+	if err := setDeviceEndorsement(ctx, asset.ID, ownerMSP); err != nil {
+		return err
+	}
+	if asset.KeyType == KeyTypeAES {
+		if err := putDeviceKey(ctx, ownerMSP, &deviceKey{ID: asset.ID, Key: key, Version: 1}); err != nil {
+			return err
 		}
 	}
-	return nil
+	return putStatusIndex(ctx, asset.Status, asset.ID)
 }
 
-// Register issues a new device to the world state with given details.
-func (s *SmartContract) Register(ctx contractapi.TransactionContextInterface, id string, status string, key string) error {
-	exists, err := s.exists(ctx, id)
+// Auth returns the credential of an active device within its validity
+// period. Only clients under the gateway policy may call it. For AES devices
+// the result carries the device key, so Auth must be evaluated rather than
+// submitted to keep the key out of the blocks, and only the gateways of the
+// owning organization receive it, from a peer of that organization.
+func (s *SmartContract) Auth(ctx contractapi.TransactionContextInterface, id string) (*DeviceCredential, error) {
+	if err := s.authorizeGateway(ctx); err != nil {
+		return nil, err
+	}
+
+	asset, err := s.readDevice(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if status := asset.statusAt(now); status != StatusActive {
+		if status == StatusSuspended && asset.SuspendedUntil != "" {
+			return nil, fmt.Errorf("the device %s is suspended until %s (%s)", id, asset.SuspendedUntil, asset.SuspensionReason)
+		}
+		return nil, fmt.Errorf("the device %s is blacklisted (status %s)", id, status)
+	}
+	if err := asset.validity().check(id, now); err != nil {
+		return nil, err
+	}
+	if err := checkLockout(ctx, id, now); err != nil {
+		return nil, err
+	}
+	if asset.keyType() != KeyTypeAES {
+		return &DeviceCredential{
+			ID:         asset.ID,
+			Status:     asset.Status,
+			KeyType:    asset.KeyType,
+			KeyVersion: asset.KeyVersion,
+			PublicKey:  asset.PublicKey,
+		}, nil
+	}
+	if err := checkOwner(ctx, asset); err != nil {
+		return nil, err
+	}
+	record, err := readDeviceKey(ctx, asset)
 	if err != nil {
+		return nil, err
+	}
+
+	return record.credential(asset, now), nil
+}
+
+// UpdateAsset updates an existing asset in the world state with provided parameters.
+// An empty status keeps the current one. Revoked devices are reactivated
+// through ProposeReactivation instead. metadataJSON is an optional JSON
+// object of the DeviceMetadata fields to change; fields it leaves out are kept.
+func (s *SmartContract) Update(ctx contractapi.TransactionContextInterface, id string, status string, metadataJSON string) error {
+	if err := s.authorizeWrite(ctx); err != nil {
 		return err
 	}
-	if exists {
-		return fmt.Errorf("the device %s already exists", id)
+	if status == "" && strings.TrimSpace(metadataJSON) == "" {
+		return fmt.Errorf("nothing to update for device %s", id)
 	}
 
-	asset := Asset{
-		ID:     id,
-		Status: status,
-		Key: key,
+	asset, err := s.readDevice(ctx, id)
+	if err != nil {
+		return err
 	}
-	assetJSON, err := json.Marshal(asset)
+	oldStatus := storedStatus(asset.Status)
+	if status == "" {
+		status = oldStatus
+	} else {
+		if status, err = parseStatus(status); err != nil {
+			return err
+		}
+		if err := checkTransition(id, oldStatus, status); err != nil {
+			return err
+		}
+		if err := checkUnapproved(id, oldStatus, status); err != nil {
+			return err
+		}
+	}
+	metadata, err := parseMetadata(asset.metadata(), metadataJSON)
 	if err != nil {
 		return err
 	}
+	updatedBy, err := invokerID(ctx)
+	if err != nil {
+		return err
+	}
+
+	// overwriting original asset with the new status and metadata
+	asset.setStatus(status)
+	asset.setMetadata(metadata)
+	asset.UpdatedBy = updatedBy
+	if err := s.putDeviceStatus(ctx, asset, oldStatus); err != nil {
+		return err
+	}
+
+	return emitDeviceEvent(ctx, EventDeviceUpdated, id, oldStatus, status)
+}
 
-	return ctx.GetStub().PutState(id, assetJSON)
+// putDeviceStatus writes a device whose status may have changed from
+// oldStatus and moves its status index entry accordingly
+func (s *SmartContract) putDeviceStatus(ctx contractapi.TransactionContextInterface, asset *Asset, oldStatus string) error {
+	if err := s.putDevice(ctx, asset); err != nil {
+		return err
+	}
+	if err := delStatusIndex(ctx, oldStatus, asset.ID); err != nil {
+		return err
+	}
+	return putStatusIndex(ctx, asset.Status, asset.ID)
 }
 
-// Auth returns the asset stored in the world state with given id.
-func (s *SmartContract) Auth(ctx contractapi.TransactionContextInterface, id string) (*Asset, error) {
-	assetJSON, err := ctx.GetStub().GetState(id)
+// deleteDevice turns the device into a tombstone. The record stays in the
+// world state marked as deleted, so the device is listed by
+// GetRevocationList, while its key, status index entry, lockout, pending
+// transfer and group memberships are removed. The ID may be registered again
+// unless reserve is set, which keeps it from ever being reused. Devices are
+// deleted through ProposeDeletion.
+func (s *SmartContract) deleteDevice(ctx contractapi.TransactionContextInterface, asset *Asset, reserve bool, updatedBy string) error {
+	id := asset.ID
+	now, err := txTime(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read from world state: %v", err)
+		return err
 	}
-	if assetJSON == nil {
-		return nil, fmt.Errorf("the device %s does not exist", id)
+	asset.DeletedAt = now.Format(time.RFC3339)
+	asset.Reserved = reserve
+	asset.UpdatedBy = updatedBy
+	if err := s.putDevice(ctx, asset); err != nil {
+		return err
 	}
+	if asset.keyType() == KeyTypeAES {
+		if err := delDeviceKey(ctx, asset.OwnerMSP, id); err != nil {
+			return err
+		}
+	}
+	status := storedStatus(asset.Status)
+	if err := delStatusIndex(ctx, status, id); err != nil {
+		return err
+	}
+	if err := putLockout(ctx, &Lockout{DeviceID: id}); err != nil {
+		return err
+	}
+	transfer, err := readTransfer(ctx, id)
+	if err != nil {
+		return err
+	}
+	if transfer != nil {
+		if err := dropTransfer(ctx, asset, transfer); err != nil {
+			return err
+		}
+	}
+	return leaveGroups(ctx, id)
+}
 
-	var asset Asset
-	err = json.Unmarshal(assetJSON, &asset)
+// readDevice returns the device stored under id, active again if its
+// suspension has ended, or an error if there is none or it has been deleted
+func (s *SmartContract) readDevice(ctx contractapi.TransactionContextInterface, id string) (*Asset, error) {
+	asset, err := readRecord(ctx, id)
 	if err != nil {
 		return nil, err
 	}
-	if asset.Status != "active" {
-		return nil, fmt.Errorf("the device %s is blacklisted", id)
+	if asset == nil {
+		return nil, fmt.Errorf("the device %s does not exist", id)
+	}
+	if asset.deleted() {
+		return nil, fmt.Errorf("the device %s was deleted at %s", id, asset.DeletedAt)
 	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	asset.endSuspension(now)
 
-	return &asset, nil
+	return asset, nil
 }
 
-// UpdateAsset updates an existing asset in the world state with provided parameters.
-func (s *SmartContract) Update(ctx contractapi.TransactionContextInterface, id string, status string) error {
-	assetJSON, err := ctx.GetStub().GetState(id)
+// readRecord returns the record stored under id, tombstones included, or
+// nil if there is none
+func readRecord(ctx contractapi.TransactionContextInterface, id string) (*Asset, error) {
+	key, err := deviceStateKey(ctx, id)
 	if err != nil {
-		return fmt.Errorf("failed to read from world state: %v", err)
+		return nil, err
+	}
+	assetJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
 	}
 	if assetJSON == nil {
-		return fmt.Errorf("the device %s does not exist", id)
+		return nil, nil
 	}
 
 	var asset Asset
 	err = json.Unmarshal(assetJSON, &asset)
 	if err != nil {
-		return err
-	}
-	pk := string(asset.Key)
-	ctx.GetStub().DelState(id)
-
-	// overwriting original asset with new asset
-	asset = Asset{ID: id, Status: status, Key: pk }
-	assetJSON, err = json.Marshal(asset)
-	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return ctx.GetStub().PutState(id, assetJSON)
+	return &asset, nil
 }
 
-// DeleteAsset deletes an given asset from the world state.
-func (s *SmartContract) Delete(ctx contractapi.TransactionContextInterface, id string) error {
-	exists, err := s.exists(ctx, id)
+// putDevice writes the device to the world state in the device namespace.
+// A device whose suspension ended since it was last written leaves the
+// suspended status index entry for the active one.
+func (s *SmartContract) putDevice(ctx contractapi.TransactionContextInterface, asset *Asset) error {
+	if asset.suspensionEnded {
+		if err := delStatusIndex(ctx, StatusSuspended, asset.ID); err != nil {
+			return err
+		}
+		if err := putStatusIndex(ctx, StatusActive, asset.ID); err != nil {
+			return err
+		}
+		asset.suspensionEnded = false
+	}
+	asset.DocType = deviceDocType
+	asset.SchemaVersion = deviceSchemaVersion
+	assetJSON, err := json.Marshal(asset)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		return fmt.Errorf("the device %s does not exist", id)
+	key, err := deviceStateKey(ctx, asset.ID)
+	if err != nil {
+		return err
 	}
 
-	return ctx.GetStub().DelState(id)
+	err = ctx.GetStub().PutState(key, assetJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put to world state. %v", err)
+	}
+	return nil
 }
 
-// AssetExists returns true when asset with given ID exists in world state
+// AssetExists returns true when a device with given ID exists in world
+// state and has not been deleted
 func (s *SmartContract) exists(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
-	assetJSON, err := ctx.GetStub().GetState(id)
+	asset, err := readRecord(ctx, id)
 	if err != nil {
-		return false, fmt.Errorf("failed to read from world state: %v", err)
+		return false, err
 	}
 
-	return assetJSON != nil, nil
+	return asset != nil && !asset.deleted(), nil
 }
 
 // GetAllAssets returns all assets found in world state
 func (s *SmartContract) GetAll(ctx contractapi.TransactionContextInterface) ([]*Device_list, error) {
-	// range query with empty string for startKey and endKey does an
-	// open-ended query of all assets in the chaincode namespace.
-	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
-	if err != nil {
+	if err := s.authorizeRead(ctx); err != nil {
 		return nil, err
 	}
-	defer resultsIterator.Close()
 
-	var devices []*Device_list
-	for resultsIterator.HasNext() {
-		queryResponse, err := resultsIterator.Next()
-		if err != nil {
-			return nil, err
-		}
-
-		var asset Asset
-		err = json.Unmarshal(queryResponse.Value, &asset)
-		if err != nil {
-			return nil, err
-		}
-		device := Device_list{
-			ID: asset.ID,
-			Status: asset.Status,
-		}
-		devices = append(devices, &device)
+	resultsIterator, err := deviceIterator(ctx)
+	if err != nil {
+		return nil, err
 	}
+	defer resultsIterator.Close()
 
-	return devices, nil
+	return collectDevices(ctx, resultsIterator)
 }
\ No newline at end of file
@@ -0,0 +1,438 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+const testKey = "0123456789abcdef"
+
+var (
+	org1Admin = &mocks.ClientIdentity{
+		MSPID:      "Org1MSP",
+		ID:         "x509::CN=admin::CN=ca.org1.example.com",
+		Attributes: map[string]string{"role": "device-admin"},
+	}
+	org2Admin = &mocks.ClientIdentity{
+		MSPID:      "Org2MSP",
+		ID:         "x509::CN=admin::CN=ca.org2.example.com",
+		Attributes: map[string]string{"role": "device-admin"},
+	}
+	org1User = &mocks.ClientIdentity{
+		MSPID: "Org1MSP",
+		ID:    "x509::CN=user1::CN=ca.org1.example.com",
+	}
+	org1LedgerAdmin = &mocks.ClientIdentity{
+		MSPID:      "Org1MSP",
+		ID:         "x509::CN=ledgeradmin::CN=ca.org1.example.com",
+		Attributes: map[string]string{"role": "ledger-admin"},
+	}
+	org1Approver = &mocks.ClientIdentity{
+		MSPID:      "Org1MSP",
+		ID:         "x509::CN=admin2::CN=ca.org1.example.com",
+		Attributes: map[string]string{"role": "device-admin"},
+	}
+	org1Gateway = &mocks.ClientIdentity{
+		MSPID:      "Org1MSP",
+		ID:         "x509::CN=gateway1::CN=ca.org1.example.com",
+		Attributes: map[string]string{"role": "device-gateway"},
+	}
+	org2Gateway = &mocks.ClientIdentity{
+		MSPID:      "Org2MSP",
+		ID:         "x509::CN=gateway1::CN=ca.org2.example.com",
+		Attributes: map[string]string{"role": "device-gateway"},
+	}
+	org3Admin = &mocks.ClientIdentity{
+		MSPID:      "Org3MSP",
+		ID:         "x509::CN=admin::CN=ca.org3.example.com",
+		Attributes: map[string]string{"role": "device-admin"},
+	}
+)
+
+// ledger runs transactions of a SmartContract against an in-memory stub
+type ledger struct {
+	t        *testing.T
+	stub     *mocks.MemoryStub
+	ctx      *mocks.TransactionContext
+	contract *chaincode.SmartContract
+	txCount  int
+}
+
+func newLedger(t *testing.T) *ledger {
+	stub := mocks.NewMemoryStub()
+	ctx := &mocks.TransactionContext{}
+	ctx.GetStubReturns(stub)
+	ctx.GetClientIdentityReturns(org1Admin)
+
+	return &ledger{t: t, stub: stub, ctx: ctx, contract: &chaincode.SmartContract{}}
+}
+
+// as makes the following transactions run as identity
+func (l *ledger) as(identity *mocks.ClientIdentity) *ledger {
+	l.ctx.GetClientIdentityReturns(identity)
+	return l
+}
+
+// submit runs fn as one transaction one second after the previous one and
+// commits its writes when it succeeds
+func (l *ledger) submit(fn func(ctx contractapi.TransactionContextInterface) error) error {
+	l.txCount++
+	l.stub.Timestamp = l.stub.Timestamp.Add(time.Second)
+	l.stub.Begin(fmt.Sprintf("tx%d", l.txCount))
+	if err := fn(l.ctx); err != nil {
+		l.stub.Rollback()
+		return err
+	}
+	l.stub.Commit()
+	return nil
+}
+
+// evaluate runs fn as a query, dropping anything it writes
+func (l *ledger) evaluate(fn func(ctx contractapi.TransactionContextInterface) error) error {
+	l.txCount++
+	l.stub.Begin(fmt.Sprintf("tx%d", l.txCount))
+	defer l.stub.Rollback()
+	return fn(l.ctx)
+}
+
+// register registers an active AES device keyed with testKey
+func (l *ledger) register(id string) {
+	l.t.Helper()
+	l.stub.Transient = map[string][]byte{"key": []byte(testKey)}
+	require.NoError(l.t, l.submit(func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.Register(ctx, id, chaincode.StatusActive, "", "", "", "", "")
+	}))
+}
+
+// update moves a device to status
+func (l *ledger) update(id string, status string) {
+	l.t.Helper()
+	require.NoError(l.t, l.submit(func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.Update(ctx, id, status, "")
+	}))
+}
+
+// delete proposes to delete a device as the current identity and approves
+// the proposal as org1Approver, which meets the default threshold
+func (l *ledger) delete(id string, reserve bool) error {
+	proposal, err := l.propose(func(ctx contractapi.TransactionContextInterface) (*chaincode.Proposal, error) {
+		return l.contract.ProposeDeletion(ctx, id, reserve)
+	})
+	if err != nil {
+		return err
+	}
+	identity := l.ctx.GetClientIdentity()
+	defer l.ctx.GetClientIdentityReturns(identity)
+	_, err = l.as(org1Approver).approve(proposal.ID)
+	return err
+}
+
+// configure commits config as the contract configuration
+func (l *ledger) configure(config chaincode.Config) {
+	l.t.Helper()
+	key, err := l.stub.CreateCompositeKey("config", []string{})
+	require.NoError(l.t, err)
+	configJSON, err := json.Marshal(config)
+	require.NoError(l.t, err)
+	l.stub.PutCommittedState(key, configJSON)
+}
+
+// asset returns the committed record of a device, or nil if there is none
+func (l *ledger) asset(id string) *chaincode.Asset {
+	l.t.Helper()
+	key, err := l.stub.CreateCompositeKey("device", []string{id})
+	require.NoError(l.t, err)
+	assetJSON, err := l.stub.GetState(key)
+	require.NoError(l.t, err)
+	if assetJSON == nil {
+		return nil
+	}
+
+	var asset chaincode.Asset
+	require.NoError(l.t, json.Unmarshal(assetJSON, &asset))
+	return &asset
+}
+
+// getAll returns the devices listed by GetAll
+func (l *ledger) getAll() []*chaincode.Device_list {
+	l.t.Helper()
+	var devices []*chaincode.Device_list
+	require.NoError(l.t, l.evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		devices, err = l.contract.GetAll(ctx)
+		return err
+	}))
+	return devices
+}
+
+// auth evaluates Auth for a device as the gateway of Org1
+func (l *ledger) auth(id string) (*chaincode.DeviceCredential, error) {
+	return l.authAs(org1Gateway, id)
+}
+
+// authAs evaluates Auth for a device as identity and then switches back to
+// the current identity
+func (l *ledger) authAs(identity *mocks.ClientIdentity, id string) (*chaincode.DeviceCredential, error) {
+	defer l.ctx.GetClientIdentityReturns(l.ctx.GetClientIdentity())
+	l.as(identity)
+
+	var credential *chaincode.DeviceCredential
+	err := l.evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		credential, err = l.contract.Auth(ctx, id)
+		return err
+	})
+	return credential, err
+}
+
+// deviceKey returns the key record of a device in the collection of mspID
+func (l *ledger) deviceKey(mspID string, id string) []byte {
+	l.t.Helper()
+	key, err := l.stub.GetPrivateData("_implicit_org_"+mspID, id)
+	require.NoError(l.t, err)
+	return key
+}
+
+// lastEvent returns the event of the last committed transaction that set one
+func (l *ledger) lastEvent() *chaincode.DeviceEvent {
+	l.t.Helper()
+	event := l.stub.LastEvent()
+	require.NotNil(l.t, event)
+
+	var payload chaincode.DeviceEvent
+	require.NoError(l.t, json.Unmarshal(event.Payload, &payload))
+	require.Equal(l.t, event.EventName, payload.Event)
+	return &payload
+}
+
+func TestInitLedger(t *testing.T) {
+	l := newLedger(t)
+	require.NoError(t, l.submit(l.contract.InitLedger))
+	require.Empty(t, l.getAll())
+
+	// running it again, as every app start does, leaves devices alone
+	l.register("D1")
+	before := l.asset("D1")
+	require.NoError(t, l.submit(l.contract.InitLedger))
+	require.NoError(t, l.submit(l.contract.InitLedger))
+	require.Equal(t, before, l.asset("D1"))
+	require.Len(t, l.getAll(), 1)
+
+	err := l.as(org1User).submit(l.contract.InitLedger)
+	require.EqualError(t, err, "access denied: the attribute role=device-admin is required to modify devices")
+}
+
+func TestRegister(t *testing.T) {
+	l := newLedger(t)
+	l.register("D1")
+
+	asset := l.asset("D1")
+	require.Equal(t, "D1", asset.ID)
+	require.Equal(t, chaincode.StatusActive, asset.Status)
+	require.Equal(t, chaincode.KeyTypeAES, asset.KeyType)
+	require.Equal(t, 1, asset.KeyVersion)
+	require.Equal(t, "Org1MSP", asset.OwnerMSP)
+	require.Equal(t, "Org1MSP/x509::CN=admin::CN=ca.org1.example.com", asset.UpdatedBy)
+
+	require.Contains(t, string(l.deviceKey("Org1MSP", "D1")), testKey)
+	require.Nil(t, l.deviceKey("Org2MSP", "D1"))
+	for _, stateKey := range l.stub.Keys() {
+		value, err := l.stub.GetState(stateKey)
+		require.NoError(t, err)
+		require.NotContains(t, string(value), testKey)
+	}
+
+	event := l.lastEvent()
+	require.Equal(t, chaincode.EventDeviceRegistered, event.Event)
+	require.Equal(t, "D1", event.DeviceID)
+	require.Equal(t, chaincode.StatusActive, event.NewStatus)
+	require.Equal(t, "2024-01-01T00:00:01Z", event.Timestamp)
+}
+
+func TestRegisterRejectsInvalidDevices(t *testing.T) {
+	l := newLedger(t)
+	l.register("D1")
+
+	register := func(id string, status string, keyType string, publicKey string, transient map[string][]byte) error {
+		l.stub.Transient = transient
+		return l.submit(func(ctx contractapi.TransactionContextInterface) error {
+			return l.contract.Register(ctx, id, status, keyType, publicKey, "", "", "")
+		})
+	}
+	key := map[string][]byte{"key": []byte(testKey)}
+
+	require.EqualError(t, register("D1", "active", "", "", key), "the device D1 already exists")
+	require.EqualError(t, register("D2", "revoked", "", "", key), "a device must be registered as pending or active, not revoked")
+	require.Error(t, register("D2", "unknown", "", "", key))
+	require.Error(t, register("D2", "active", "rsa", "", key))
+	require.EqualError(t, register("D2", "active", "", "", nil), `the device key must be passed in the transient map under "key"`)
+	require.EqualError(t, register("D2", "active", "", "", map[string][]byte{"key": []byte("short")}), "the device key must be 16, 24 or 32 bytes long, got 5")
+	require.EqualError(t, register("D2", "active", "aes", "pem", key), "AES devices do not take a public key")
+	require.Error(t, register("D2", "active", "ecdsa", "not a pem", nil))
+
+	err := l.as(org1User).submit(func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.Register(ctx, "D2", "active", "", "", "", "", "")
+	})
+	require.EqualError(t, err, "access denied: the attribute role=device-admin is required to modify devices")
+	err = l.as(org3Admin).submit(func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.Register(ctx, "D2", "active", "", "", "", "", "")
+	})
+	require.EqualError(t, err, "access denied: clients of Org3MSP are not allowed to modify devices")
+
+	require.Nil(t, l.asset("D2"))
+}
+
+func TestAuth(t *testing.T) {
+	l := newLedger(t)
+	l.register("D1")
+
+	credential, err := l.auth("D1")
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.DeviceCredential{
+		ID:         "D1",
+		Status:     chaincode.StatusActive,
+		Key:        testKey,
+		KeyType:    chaincode.KeyTypeAES,
+		KeyVersion: 1,
+	}, credential)
+
+	_, err = l.auth("D2")
+	require.EqualError(t, err, "the device D2 does not exist")
+
+	// only the gateways of the owning organization get the key
+	_, err = l.authAs(org2Gateway, "D1")
+	require.EqualError(t, err, "access denied: the device D1 is owned by Org1MSP")
+
+	l.as(org1Admin).update("D1", chaincode.StatusSuspended)
+	_, err = l.auth("D1")
+	require.EqualError(t, err, "the device D1 is blacklisted (status suspended)")
+
+	// reading devices does not give access to their keys
+	_, err = l.authAs(org1User, "D1")
+	require.EqualError(t, err, "access denied: the attribute role=device-gateway is required to authenticate devices")
+	_, err = l.authAs(org1Admin, "D1")
+	require.EqualError(t, err, "access denied: the attribute role=device-gateway is required to authenticate devices")
+	_, err = l.authAs(org3Admin, "D1")
+	require.EqualError(t, err, "access denied: clients of Org3MSP are not allowed to authenticate devices")
+}
+
+func TestUpdate(t *testing.T) {
+	l := newLedger(t)
+	l.register("D1")
+
+	l.update("D1", "Suspended")
+	require.Equal(t, chaincode.StatusSuspended, l.asset("D1").Status)
+	event := l.lastEvent()
+	require.Equal(t, chaincode.EventDeviceUpdated, event.Event)
+	require.Equal(t, chaincode.StatusActive, event.OldStatus)
+	require.Equal(t, chaincode.StatusSuspended, event.NewStatus)
+
+	update := func(id string, status string, metadata string) error {
+		return l.submit(func(ctx contractapi.TransactionContextInterface) error {
+			return l.contract.Update(ctx, id, status, metadata)
+		})
+	}
+	require.EqualError(t, update("D1", "suspended", ""), "the device D1 is already suspended")
+	require.EqualError(t, update("D1", "pending", ""), "the device D1 cannot move from suspended to pending")
+	require.EqualError(t, update("D1", "", ""), "nothing to update for device D1")
+	require.EqualError(t, update("D2", "active", ""), "the device D2 does not exist")
+
+	l.update("D1", chaincode.StatusDecommissioned)
+	require.EqualError(t, update("D1", "active", ""), "the device D1 cannot move from decommissioned to active")
+
+	err := l.as(org1User).submit(func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.Update(ctx, "D1", "active", "")
+	})
+	require.Error(t, err)
+}
+
+func TestDelete(t *testing.T) {
+	l := newLedger(t)
+	l.register("D1")
+	l.register("D2")
+
+	require.NoError(t, l.delete("D1", false))
+	asset := l.asset("D1")
+	require.Equal(t, "2024-01-01T00:00:04Z", asset.DeletedAt)
+	require.False(t, asset.Reserved)
+	require.Nil(t, l.deviceKey("Org1MSP", "D1"))
+
+	event := l.lastEvent()
+	require.Equal(t, chaincode.EventDeviceDeleted, event.Event)
+	require.Equal(t, chaincode.StatusActive, event.OldStatus)
+
+	devices := l.getAll()
+	require.Len(t, devices, 1)
+	require.Equal(t, "D2", devices[0].ID)
+
+	err := l.delete("D1", false)
+	require.EqualError(t, err, "the device D1 was deleted at 2024-01-01T00:00:04Z")
+	_, err = l.auth("D1")
+	require.EqualError(t, err, "the device D1 was deleted at 2024-01-01T00:00:04Z")
+
+	// the ID of a deleted device may be registered again unless it was reserved
+	l.register("D1")
+	require.Empty(t, l.asset("D1").DeletedAt)
+	require.Len(t, l.getAll(), 2)
+
+	require.NoError(t, l.delete("D2", true))
+	require.True(t, l.asset("D2").Reserved)
+	l.stub.Transient = map[string][]byte{"key": []byte(testKey)}
+	err = l.submit(func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.Register(ctx, "D2", chaincode.StatusActive, "", "", "", "", "")
+	})
+	require.EqualError(t, err, "the device ID D2 was reserved when the device was deleted and cannot be reused")
+}
+
+func TestGetAll(t *testing.T) {
+	l := newLedger(t)
+	require.Empty(t, l.getAll())
+
+	l.register("D2")
+	l.register("D1")
+	l.update("D2", chaincode.StatusRevoked)
+	require.NoError(t, l.submit(func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.CreateGroup(ctx, "site-a", "")
+	}))
+
+	devices := l.getAll()
+	require.Len(t, devices, 2)
+	require.Equal(t, "D1", devices[0].ID)
+	require.Equal(t, chaincode.StatusActive, devices[0].Status)
+	require.Equal(t, "D2", devices[1].ID)
+	require.Equal(t, chaincode.StatusRevoked, devices[1].Status)
+	require.Equal(t, 2, devices[1].SchemaVersion)
+
+	err := l.as(org3Admin).evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		_, err := l.contract.GetAll(ctx)
+		return err
+	})
+	require.Error(t, err)
+}
+
+func TestFailedTransactionsLeaveNoTrace(t *testing.T) {
+	l := newLedger(t)
+	l.register("D1")
+	keys := l.stub.Keys()
+	events := len(l.stub.Events)
+
+	err := l.submit(func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.Update(ctx, "D1", "pending", "")
+	})
+	require.Error(t, err)
+	require.Equal(t, keys, l.stub.Keys())
+	require.Len(t, l.stub.Events, events)
+	require.Equal(t, chaincode.StatusActive, l.asset("D1").Status)
+}
+
+func TestContractMetadata(t *testing.T) {
+	_, err := contractapi.NewChaincode(&chaincode.SmartContract{})
+	require.NoError(t, err)
+}
@@ -0,0 +1,200 @@
+package chaincode
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// revocationSnapshotKey is the composite key object type of the last
+// anchored revocation snapshot. Earlier snapshots remain in its history.
+const revocationSnapshotKey = "revocationsnapshot"
+
+// ReasonExpired is the snapshot reason of devices past their ValidUntil
+const ReasonExpired = "expired"
+
+// RevocationSnapshot records the Merkle root over every device Auth refused
+// when the snapshot was anchored, together with the entries it was built
+// from so that inclusion proofs can be derived from the ledger alone.
+//
+// Entries are ordered by ID. The leaf of an entry is
+// SHA-256(0x00 || ID || 0x00 || Reason) and an inner node is
+// SHA-256(0x01 || left || right). Each level pairs nodes from the left and
+// a node left without a partner moves up unchanged. The root of an empty
+// snapshot is SHA-256 of no input. Root is hex encoded.
+type RevocationSnapshot struct {
+	Root       string           `json:"Root"`
+	Count      int              `json:"Count"`
+	AnchoredAt string           `json:"AnchoredAt"`
+	AnchoredBy string           `json:"AnchoredBy"`
+	TxID       string           `json:"TxID"`
+	Entries    []*SnapshotEntry `json:"Entries"`
+}
+
+// SnapshotEntry is one refused device of a revocation snapshot. Reason is
+// ReasonDeleted, ReasonExpired or the status of the device.
+type SnapshotEntry struct {
+	ID     string `json:"ID"`
+	Reason string `json:"Reason"`
+}
+
+// AnchorRevocationSnapshot computes the Merkle root over the devices that
+// are deleted, expired or in any status other than active and records it,
+// replacing the previous snapshot
+func (s *SmartContract) AnchorRevocationSnapshot(ctx contractapi.TransactionContextInterface) (*RevocationSnapshot, error) {
+	if err := s.authorizeWrite(ctx); err != nil {
+		return nil, err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	anchoredBy, err := invokerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resultsIterator, err := deviceIterator(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	entries := []*SnapshotEntry{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var asset Asset
+		err = json.Unmarshal(queryResponse.Value, &asset)
+		if err != nil {
+			return nil, err
+		}
+		if entry := asset.snapshotEntry(now); entry != nil {
+			entries = append(entries, entry)
+		}
+	}
+
+	snapshot := RevocationSnapshot{
+		Root:       hex.EncodeToString(merkleRoot(entries)),
+		Count:      len(entries),
+		AnchoredAt: now.Format(time.RFC3339),
+		AnchoredBy: anchoredBy,
+		TxID:       ctx.GetStub().GetTxID(),
+		Entries:    entries,
+	}
+	if err := putSnapshot(ctx, &snapshot); err != nil {
+		return nil, err
+	}
+
+	err = emitEvent(ctx, &DeviceEvent{Event: EventRevocationSnapshot, MerkleRoot: snapshot.Root})
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// GetRevocationSnapshot returns the last anchored revocation snapshot
+func (s *SmartContract) GetRevocationSnapshot(ctx contractapi.TransactionContextInterface) (*RevocationSnapshot, error) {
+	if err := s.authorizeRead(ctx); err != nil {
+		return nil, err
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(revocationSnapshotKey, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snapshot key: %v", err)
+	}
+	snapshotJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read revocation snapshot: %v", err)
+	}
+	if snapshotJSON == nil {
+		return nil, fmt.Errorf("no revocation snapshot has been anchored")
+	}
+
+	var snapshot RevocationSnapshot
+	if err := json.Unmarshal(snapshotJSON, &snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// snapshotEntry returns the snapshot entry of the device, or nil if Auth
+// accepted the device at now
+func (asset *Asset) snapshotEntry(now time.Time) *SnapshotEntry {
+	if revoked := asset.revocation(); revoked != nil {
+		return &SnapshotEntry{ID: asset.ID, Reason: revoked.Reason}
+	}
+	if status := asset.statusAt(now); status != StatusActive {
+		return &SnapshotEntry{ID: asset.ID, Reason: status}
+	}
+	if asset.validity().expired(now) {
+		return &SnapshotEntry{ID: asset.ID, Reason: ReasonExpired}
+	}
+	return nil
+}
+
+func putSnapshot(ctx contractapi.TransactionContextInterface, snapshot *RevocationSnapshot) error {
+	snapshotJSON, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(revocationSnapshotKey, []string{})
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot key: %v", err)
+	}
+	if err := ctx.GetStub().PutState(key, snapshotJSON); err != nil {
+		return fmt.Errorf("failed to put revocation snapshot: %v", err)
+	}
+	return nil
+}
+
+// merkleRoot returns the root of the Merkle tree over the entries, built as
+// described on RevocationSnapshot
+func merkleRoot(entries []*SnapshotEntry) []byte {
+	if len(entries) == 0 {
+		root := sha256.Sum256(nil)
+		return root[:]
+	}
+
+	level := make([][]byte, len(entries))
+	for i, entry := range entries {
+		level[i] = entry.leaf()
+	}
+	for len(level) > 1 {
+		var next [][]byte
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			next = append(next, merkleNode(level[i], level[i+1]))
+		}
+		level = next
+	}
+	return level[0]
+}
+
+// leaf returns the Merkle leaf hash of the entry
+func (entry *SnapshotEntry) leaf() []byte {
+	hash := sha256.New()
+	hash.Write([]byte{0})
+	hash.Write([]byte(entry.ID))
+	hash.Write([]byte{0})
+	hash.Write([]byte(entry.Reason))
+	return hash.Sum(nil)
+}
+
+func merkleNode(left []byte, right []byte) []byte {
+	hash := sha256.New()
+	hash.Write([]byte{1})
+	hash.Write(left)
+	hash.Write(right)
+	return hash.Sum(nil)
+}
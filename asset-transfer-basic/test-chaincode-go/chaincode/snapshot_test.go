@@ -0,0 +1,89 @@
+package chaincode_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func snapshotLeaf(id string, reason string) []byte {
+	hash := sha256.Sum256([]byte("\x00" + id + "\x00" + reason))
+	return hash[:]
+}
+
+func snapshotNode(left []byte, right []byte) []byte {
+	hash := sha256.Sum256(append(append([]byte{1}, left...), right...))
+	return hash[:]
+}
+
+func (l *ledger) anchorSnapshot() *chaincode.RevocationSnapshot {
+	l.t.Helper()
+	var snapshot *chaincode.RevocationSnapshot
+	require.NoError(l.t, l.submit(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		snapshot, err = l.contract.AnchorRevocationSnapshot(ctx)
+		return err
+	}))
+	return snapshot
+}
+
+func TestAnchorRevocationSnapshot(t *testing.T) {
+	l := newLedger(t)
+	err := l.evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		_, err := l.contract.GetRevocationSnapshot(ctx)
+		return err
+	})
+	require.EqualError(t, err, "no revocation snapshot has been anchored")
+
+	empty := sha256.Sum256(nil)
+	snapshot := l.anchorSnapshot()
+	require.Equal(t, hex.EncodeToString(empty[:]), snapshot.Root)
+	require.Empty(t, snapshot.Entries)
+
+	for _, id := range []string{"D1", "D2", "D3", "D4", "D5"} {
+		l.register(id)
+	}
+	l.update("D1", chaincode.StatusRevoked)
+	l.update("D2", chaincode.StatusSuspended)
+	require.NoError(t, l.setValidity("D3", "", "2024-01-01T00:00:10Z"))
+	require.NoError(t, l.delete("D4", false))
+	l.stub.Timestamp = time.Date(2024, 1, 1, 0, 1, 0, 0, time.UTC)
+
+	snapshot = l.anchorSnapshot()
+	require.Equal(t, []*chaincode.SnapshotEntry{
+		{ID: "D1", Reason: chaincode.StatusRevoked},
+		{ID: "D2", Reason: chaincode.StatusSuspended},
+		{ID: "D3", Reason: chaincode.ReasonExpired},
+		{ID: "D4", Reason: chaincode.ReasonDeleted},
+	}, snapshot.Entries)
+	require.Equal(t, 4, snapshot.Count)
+	require.Equal(t, "2024-01-01T00:01:01Z", snapshot.AnchoredAt)
+	require.Equal(t, "tx13", snapshot.TxID)
+
+	root := snapshotNode(
+		snapshotNode(snapshotLeaf("D1", "revoked"), snapshotLeaf("D2", "suspended")),
+		snapshotNode(snapshotLeaf("D3", "expired"), snapshotLeaf("D4", "deleted")),
+	)
+	require.Equal(t, hex.EncodeToString(root), snapshot.Root)
+	event := l.lastEvent()
+	require.Equal(t, chaincode.EventRevocationSnapshot, event.Event)
+	require.Equal(t, snapshot.Root, event.MerkleRoot)
+
+	var anchored *chaincode.RevocationSnapshot
+	require.NoError(t, l.as(org1User).evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		anchored, err = l.contract.GetRevocationSnapshot(ctx)
+		return err
+	}))
+	require.Equal(t, snapshot, anchored)
+
+	// a node without a partner moves up unchanged
+	l.as(org1Admin).update("D5", chaincode.StatusSuspended)
+	snapshot = l.anchorSnapshot()
+	require.Equal(t, hex.EncodeToString(snapshotNode(root, snapshotLeaf("D5", "suspended"))), snapshot.Root)
+}
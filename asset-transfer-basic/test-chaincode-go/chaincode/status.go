@@ -0,0 +1,95 @@
+package chaincode
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Device lifecycle statuses. Only active devices pass Auth.
+const (
+	StatusPending        = "pending"
+	StatusActive         = "active"
+	StatusSuspended      = "suspended"
+	StatusRevoked        = "revoked"
+	StatusDecommissioned = "decommissioned"
+)
+
+// statuses lists every status in lifecycle order
+var statuses = []string{StatusPending, StatusActive, StatusSuspended, StatusRevoked, StatusDecommissioned}
+
+// statusTransitions maps each status to the statuses Update may move it to
+var statusTransitions = map[string][]string{
+	StatusPending:        {StatusActive, StatusRevoked, StatusDecommissioned},
+	StatusActive:         {StatusSuspended, StatusRevoked, StatusDecommissioned},
+	StatusSuspended:      {StatusActive, StatusRevoked, StatusDecommissioned},
+	StatusRevoked:        {StatusActive, StatusDecommissioned},
+	StatusDecommissioned: {},
+}
+
+// initialStatuses are the statuses a device may be registered with
+var initialStatuses = []string{StatusPending, StatusActive}
+
+// legacyStatuses maps statuses written before the lifecycle was enforced.
+// Any other status outside the lifecycle reads as revoked, so that such a
+// device only becomes active again through an approved reactivation.
+var legacyStatuses = map[string]string{
+	"admin": StatusPending,
+}
+
+// StatusInfo describes a device status and the statuses reachable from it
+type StatusInfo struct {
+	Status      string   `json:"Status"`
+	Transitions []string `json:"Transitions"`
+}
+
+// GetStatuses returns the device lifecycle enforced by Register and Update
+func (s *SmartContract) GetStatuses(ctx contractapi.TransactionContextInterface) ([]*StatusInfo, error) {
+	if err := s.authorizeRead(ctx); err != nil {
+		return nil, err
+	}
+
+	var infos []*StatusInfo
+	for _, status := range statuses {
+		infos = append(infos, &StatusInfo{
+			Status:      status,
+			Transitions: append([]string{}, statusTransitions[status]...),
+		})
+	}
+	return infos, nil
+}
+
+// parseStatus validates a status supplied by a client, ignoring case
+func parseStatus(status string) (string, error) {
+	normalized := strings.ToLower(strings.TrimSpace(status))
+	if _, ok := statusTransitions[normalized]; !ok {
+		return "", fmt.Errorf("invalid device status %q, expected one of %s", status, strings.Join(statuses, ", "))
+	}
+	return normalized, nil
+}
+
+// storedStatus normalizes a status read from the ledger, mapping legacy
+// values into the lifecycle
+func storedStatus(status string) string {
+	normalized := strings.ToLower(strings.TrimSpace(status))
+	if mapped, ok := legacyStatuses[normalized]; ok {
+		return mapped
+	}
+	if _, ok := statusTransitions[normalized]; !ok {
+		return StatusRevoked
+	}
+	return normalized
+}
+
+// checkTransition returns an error unless a device may move from one status to another.
+func checkTransition(id string, from string, to string) error {
+	allowed := statusTransitions[from]
+	if from == to {
+		return fmt.Errorf("the device %s is already %s", id, to)
+	}
+	if !contains(allowed, to) {
+		return fmt.Errorf("the device %s cannot move from %s to %s", id, from, to)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetStatuses(t *testing.T) {
+	l := newLedger(t)
+
+	var infos []*chaincode.StatusInfo
+	require.NoError(t, l.as(org1User).evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		infos, err = l.contract.GetStatuses(ctx)
+		return err
+	}))
+	require.Len(t, infos, 5)
+	require.Equal(t, chaincode.StatusPending, infos[0].Status)
+	require.Equal(t, []string{chaincode.StatusActive, chaincode.StatusRevoked, chaincode.StatusDecommissioned}, infos[0].Transitions)
+	require.Equal(t, chaincode.StatusDecommissioned, infos[4].Status)
+	require.Empty(t, infos[4].Transitions)
+}
+
+func TestLegacyStatuses(t *testing.T) {
+	l := newLedger(t)
+	key, err := l.stub.CreateCompositeKey("device", []string{"D0"})
+	require.NoError(t, err)
+	l.stub.PutCommittedState(key, []byte(`{"ID":"D0","Status":"Admin"}`))
+
+	// "Admin" was written before the lifecycle existed and reads as pending
+	l.update("D0", chaincode.StatusActive)
+	require.Equal(t, chaincode.StatusActive, l.asset("D0").Status)
+
+	// any other status outside the lifecycle reads as revoked and needs an
+	// approved reactivation to become active
+	l.stub.PutCommittedState(key, []byte(`{"ID":"D0","Status":"blocked"}`))
+	_, err = l.auth("D0")
+	require.EqualError(t, err, "the device D0 is blacklisted (status revoked)")
+	err = l.submit(func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.Update(ctx, "D0", chaincode.StatusActive, "")
+	})
+	require.EqualError(t, err, "the revoked device D0 can only be reactivated through ProposeReactivation")
+	require.Equal(t, "blocked", l.asset("D0").Status)
+	l.update("D0", chaincode.StatusDecommissioned)
+	require.Equal(t, chaincode.StatusDecommissioned, l.asset("D0").Status)
+}
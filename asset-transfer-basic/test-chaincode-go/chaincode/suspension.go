@@ -0,0 +1,109 @@
+package chaincode
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// maxReasonCodeLength bounds the reason code of a suspension
+const maxReasonCodeLength = 32
+
+var reasonCodePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Suspend suspends a device until the given RFC3339 time, recording reason
+// as a short code such as "maintenance". Auth refuses the device until then
+// and accepts it again afterwards without another transaction. From then on
+// reads report the device active, and the next write of the device stores
+// it so. Suspending a device that is already suspended replaces the end and
+// the reason. The DeviceUpdated event carries both.
+func (s *SmartContract) Suspend(ctx contractapi.TransactionContextInterface, id string, until string, reason string) error {
+	if err := s.authorizeWrite(ctx); err != nil {
+		return err
+	}
+
+	reason = strings.ToLower(strings.TrimSpace(reason))
+	if len(reason) > maxReasonCodeLength || !reasonCodePattern.MatchString(reason) {
+		return fmt.Errorf("invalid reason %q, reasons are codes of up to %d lower-case letters, digits, _ or - characters", reason, maxReasonCodeLength)
+	}
+	end, err := time.Parse(time.RFC3339, strings.TrimSpace(until))
+	if err != nil {
+		return fmt.Errorf("invalid until %q, expected an RFC3339 timestamp such as 2025-01-31T00:00:00Z", until)
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	if !end.After(now) {
+		return fmt.Errorf("the suspension must end after %s", now.Format(time.RFC3339))
+	}
+
+	asset, err := s.readDevice(ctx, id)
+	if err != nil {
+		return err
+	}
+	oldStatus := storedStatus(asset.Status)
+	if oldStatus != StatusSuspended {
+		if err := checkTransition(id, oldStatus, StatusSuspended); err != nil {
+			return err
+		}
+	}
+	updatedBy, err := invokerID(ctx)
+	if err != nil {
+		return err
+	}
+
+	asset.Status = StatusSuspended
+	asset.SuspendedUntil = end.UTC().Format(time.RFC3339)
+	asset.SuspensionReason = reason
+	asset.UpdatedBy = updatedBy
+	if err := s.putDeviceStatus(ctx, asset, oldStatus); err != nil {
+		return err
+	}
+
+	return emitEvent(ctx, &DeviceEvent{
+		Event:            EventDeviceUpdated,
+		DeviceID:         id,
+		OldStatus:        oldStatus,
+		NewStatus:        StatusSuspended,
+		SuspendedUntil:   asset.SuspendedUntil,
+		SuspensionReason: asset.SuspensionReason,
+	})
+}
+
+// setStatus moves the device to status, dropping a temporary suspension
+// when the status changes
+func (asset *Asset) setStatus(status string) {
+	if status != storedStatus(asset.Status) {
+		asset.SuspendedUntil = ""
+		asset.SuspensionReason = ""
+	}
+	asset.Status = status
+}
+
+// statusAt returns the status of the device at now. A suspended device whose
+// suspension has ended is active again.
+func (asset *Asset) statusAt(now time.Time) string {
+	status := storedStatus(asset.Status)
+	if status != StatusSuspended || asset.SuspendedUntil == "" {
+		return status
+	}
+	until, err := time.Parse(time.RFC3339, asset.SuspendedUntil)
+	if err != nil || now.Before(until) {
+		return status
+	}
+	return StatusActive
+}
+
+// endSuspension makes the device active if its suspension has ended at now.
+// The stored record stays suspended until the device is next written.
+func (asset *Asset) endSuspension(now time.Time) {
+	if asset.statusAt(now) == storedStatus(asset.Status) {
+		return
+	}
+	asset.setStatus(StatusActive)
+	asset.suspensionEnded = true
+}
@@ -0,0 +1,182 @@
+package chaincode_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func (l *ledger) suspend(id string, until string, reason string) error {
+	return l.submit(func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.Suspend(ctx, id, until, reason)
+	})
+}
+
+// indexed returns the IDs under status in the status~id index
+func (l *ledger) indexed(status string) []string {
+	l.t.Helper()
+	var ids []string
+	require.NoError(l.t, l.evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey("status~id", []string{status})
+		if err != nil {
+			return err
+		}
+		defer resultsIterator.Close()
+		for resultsIterator.HasNext() {
+			queryResponse, err := resultsIterator.Next()
+			if err != nil {
+				return err
+			}
+			_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, attributes[1])
+		}
+		return nil
+	}))
+	return ids
+}
+
+func TestSuspend(t *testing.T) {
+	l := newLedger(t)
+	l.register("D1")
+
+	require.NoError(t, l.suspend("D1", "2024-01-01T06:00:00+02:00", " Maintenance "))
+	asset := l.asset("D1")
+	require.Equal(t, chaincode.StatusSuspended, asset.Status)
+	require.Equal(t, "2024-01-01T04:00:00Z", asset.SuspendedUntil)
+	require.Equal(t, "maintenance", asset.SuspensionReason)
+	event := l.lastEvent()
+	require.Equal(t, chaincode.EventDeviceUpdated, event.Event)
+	require.Equal(t, chaincode.StatusActive, event.OldStatus)
+	require.Equal(t, chaincode.StatusSuspended, event.NewStatus)
+	require.Equal(t, "2024-01-01T04:00:00Z", event.SuspendedUntil)
+	require.Equal(t, "maintenance", event.SuspensionReason)
+	require.Equal(t, []string{"D1"}, l.listByStatus(chaincode.StatusSuspended))
+
+	_, err := l.auth("D1")
+	require.EqualError(t, err, "the device D1 is suspended until 2024-01-01T04:00:00Z (maintenance)")
+
+	// the suspension ends with the first transaction at or after its end,
+	// and the record keeps it until the device is next written
+	l.stub.Timestamp = time.Date(2024, 1, 1, 4, 0, 0, 0, time.UTC)
+	_, err = l.auth("D1")
+	require.NoError(t, err)
+	require.Equal(t, chaincode.StatusSuspended, l.asset("D1").Status)
+
+	devices := l.getAll()
+	require.Equal(t, chaincode.StatusActive, devices[0].Status)
+	require.Empty(t, devices[0].SuspendedUntil)
+	require.Empty(t, devices[0].SuspensionReason)
+	require.Equal(t, []string{"D1"}, l.listByStatus(chaincode.StatusActive))
+	require.Empty(t, l.listByStatus(chaincode.StatusSuspended))
+
+	var entries []*chaincode.DeviceHistoryEntry
+	require.NoError(t, l.evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		entries, err = l.contract.GetDeviceHistory(ctx, "D1")
+		return err
+	}))
+	require.Equal(t, "maintenance", entries[0].SuspensionReason)
+	require.Equal(t, "2024-01-01T04:00:00Z", entries[0].SuspendedUntil)
+	require.Empty(t, entries[1].SuspensionReason)
+
+	require.NoError(t, l.submit(func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.Update(ctx, "D1", "", `{"Site":"lab"}`)
+	}))
+	asset = l.asset("D1")
+	require.Equal(t, chaincode.StatusActive, asset.Status)
+	require.Empty(t, asset.SuspendedUntil)
+	require.Empty(t, asset.SuspensionReason)
+	require.Equal(t, chaincode.StatusActive, l.lastEvent().OldStatus)
+	require.Equal(t, []string{"D1"}, l.indexed(chaincode.StatusActive))
+	require.Empty(t, l.indexed(chaincode.StatusSuspended))
+
+	// suspending again replaces the end and the reason
+	require.NoError(t, l.suspend("D1", "2024-01-02T00:00:00Z", "investigation"))
+	_, err = l.auth("D1")
+	require.EqualError(t, err, "the device D1 is suspended until 2024-01-02T00:00:00Z (investigation)")
+
+	// changing the status drops the suspension
+	l.update("D1", chaincode.StatusActive)
+	asset = l.asset("D1")
+	require.Empty(t, asset.SuspendedUntil)
+	require.Empty(t, asset.SuspensionReason)
+	l.update("D1", chaincode.StatusSuspended)
+	_, err = l.auth("D1")
+	require.EqualError(t, err, "the device D1 is blacklisted (status suspended)")
+}
+
+func TestEndedSuspensionPages(t *testing.T) {
+	l := newLedger(t)
+	for _, id := range []string{"D1", "D2", "D3", "D4"} {
+		l.register(id)
+	}
+	require.NoError(t, l.suspend("D1", "2024-01-01T01:00:00Z", "maintenance"))
+	require.NoError(t, l.suspend("D3", "2024-01-01T02:00:00Z", "maintenance"))
+	l.update("D4", chaincode.StatusSuspended)
+	l.stub.Timestamp = time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC)
+
+	getPage := func(pageSize int32, bookmark string, status string) *chaincode.DevicePage {
+		var page *chaincode.DevicePage
+		require.NoError(t, l.evaluate(func(ctx contractapi.TransactionContextInterface) error {
+			var err error
+			page, err = l.contract.GetAllPaginated(ctx, pageSize, bookmark, status)
+			return err
+		}))
+		return page
+	}
+
+	// D1 is listed with the active devices once the active entries run
+	// out, and the pages over D3 and D4 come back empty
+	var ids []string
+	bookmark := ""
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 4)
+		page := getPage(1, bookmark, chaincode.StatusActive)
+		for _, device := range page.Devices {
+			require.Equal(t, chaincode.StatusActive, device.Status)
+			ids = append(ids, device.ID)
+		}
+		if bookmark = page.Bookmark; bookmark == "" {
+			break
+		}
+	}
+	require.Equal(t, []string{"D2", "D1"}, ids)
+
+	page := getPage(10, "", chaincode.StatusSuspended)
+	require.Len(t, page.Devices, 2)
+	require.Equal(t, "D3", page.Devices[0].ID)
+	require.Equal(t, "D4", page.Devices[1].ID)
+	require.Equal(t, []string{"D1", "D2"}, l.listByStatus(chaincode.StatusActive))
+	require.Equal(t, []string{"D3", "D4"}, l.listByStatus(chaincode.StatusSuspended))
+}
+
+func TestSuspendErrors(t *testing.T) {
+	l := newLedger(t)
+	l.register("D1")
+	l.register("D2")
+	l.update("D2", chaincode.StatusDecommissioned)
+
+	require.EqualError(t, l.suspend("D1", "2024-01-02T00:00:00Z", ""), `invalid reason "", reasons are codes of up to 32 lower-case letters, digits, _ or - characters`)
+	require.EqualError(t, l.suspend("D1", "2024-01-02T00:00:00Z", "firmware update"), `invalid reason "firmware update", reasons are codes of up to 32 lower-case letters, digits, _ or - characters`)
+	require.EqualError(t, l.suspend("D1", "tomorrow", "maintenance"), `invalid until "tomorrow", expected an RFC3339 timestamp such as 2025-01-31T00:00:00Z`)
+	require.EqualError(t, l.suspend("D1", "2024-01-01T00:00:00Z", "maintenance"), "the suspension must end after 2024-01-01T00:00:07Z")
+	require.EqualError(t, l.suspend("D2", "2024-01-02T00:00:00Z", "maintenance"), "the device D2 cannot move from decommissioned to suspended")
+	require.EqualError(t, l.suspend("D3", "2024-01-02T00:00:00Z", "maintenance"), "the device D3 does not exist")
+	require.EqualError(t, l.as(org1User).suspend("D1", "2024-01-02T00:00:00Z", "maintenance"), "access denied: the attribute role=device-admin is required to modify devices")
+}
+
+func TestSuspensionSnapshot(t *testing.T) {
+	l := newLedger(t)
+	l.register("D1")
+	require.NoError(t, l.suspend("D1", "2024-01-01T01:00:00Z", "maintenance"))
+
+	require.Equal(t, []*chaincode.SnapshotEntry{{ID: "D1", Reason: chaincode.StatusSuspended}}, l.anchorSnapshot().Entries)
+	l.stub.Timestamp = time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC)
+	require.Empty(t, l.anchorSnapshot().Entries)
+}
@@ -0,0 +1,302 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// transferIndex is the composite key object type of pending transfers
+const transferIndex = "transfer~id"
+
+// DeviceTransfer is a transfer of ownership waiting for the receiving
+// organization to accept it
+type DeviceTransfer struct {
+	DeviceID    string `json:"DeviceID"`
+	FromMSP     string `json:"FromMSP"`
+	ToMSP       string `json:"ToMSP"`
+	RequestedBy string `json:"RequestedBy"`
+	RequestedAt string `json:"RequestedAt"`
+}
+
+// TransferDevice hands a device over to another organization. Only clients
+// of the owning organization may start a transfer. When the contract
+// requires acceptance the transfer stays pending until a client of the
+// receiving organization calls AcceptTransfer; otherwise it takes effect
+// immediately. Devices registered before owners were recorded may be
+// transferred by any client allowed to modify devices.
+//
+// Completing a transfer hands the key-level endorsement policy of the device
+// to the new owner. That change is validated against the old policy, so when
+// the receiver accepts, the transaction must also be endorsed by a peer of
+// the previous owner.
+//
+// The key of an AES device is copied to the collection of the receiving
+// organization when the transfer starts, while the owner's peers can still
+// read it, and removed from the collection of the previous owner when the
+// transfer completes.
+func (s *SmartContract) TransferDevice(ctx contractapi.TransactionContextInterface, id string, newOwnerMSP string) error {
+	if err := s.authorizeWrite(ctx); err != nil {
+		return err
+	}
+
+	asset, err := s.readDevice(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := checkOwner(ctx, asset); err != nil {
+		return err
+	}
+	if storedStatus(asset.Status) == StatusDecommissioned {
+		return fmt.Errorf("the device %s is decommissioned and cannot be transferred", id)
+	}
+	if newOwnerMSP == "" {
+		return fmt.Errorf("the new owner MSP must not be empty")
+	}
+	if newOwnerMSP == asset.OwnerMSP {
+		return fmt.Errorf("the device %s is already owned by %s", id, newOwnerMSP)
+	}
+	config, err := readConfig(ctx)
+	if err != nil {
+		return err
+	}
+	if policy := config.writePolicy(); len(policy.MSPIDs) > 0 && !contains(policy.MSPIDs, newOwnerMSP) {
+		return fmt.Errorf("clients of %s are not allowed to modify devices and cannot own them", newOwnerMSP)
+	}
+	pending, err := readTransfer(ctx, id)
+	if err != nil {
+		return err
+	}
+	if pending != nil {
+		return fmt.Errorf("the device %s already has a pending transfer to %s", id, pending.ToMSP)
+	}
+	if err := copyDeviceKey(ctx, asset, newOwnerMSP); err != nil {
+		return err
+	}
+
+	if !config.RequireTransferAcceptance {
+		return s.completeTransfer(ctx, asset, newOwnerMSP)
+	}
+
+	requestedBy, err := invokerID(ctx)
+	if err != nil {
+		return err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	transfer := DeviceTransfer{
+		DeviceID:    id,
+		FromMSP:     asset.OwnerMSP,
+		ToMSP:       newOwnerMSP,
+		RequestedBy: requestedBy,
+		RequestedAt: now.Format(time.RFC3339),
+	}
+	if err := putTransfer(ctx, &transfer); err != nil {
+		return err
+	}
+
+	return emitEvent(ctx, &DeviceEvent{
+		Event:    EventDeviceTransferRequested,
+		DeviceID: id,
+		FromMSP:  transfer.FromMSP,
+		ToMSP:    transfer.ToMSP,
+	})
+}
+
+// AcceptTransfer completes the pending transfer of a device. Only clients of
+// the receiving organization may accept it.
+func (s *SmartContract) AcceptTransfer(ctx contractapi.TransactionContextInterface, id string) error {
+	if err := s.authorizeWrite(ctx); err != nil {
+		return err
+	}
+
+	transfer, err := readTransfer(ctx, id)
+	if err != nil {
+		return err
+	}
+	if transfer == nil {
+		return fmt.Errorf("the device %s has no pending transfer", id)
+	}
+	mspID, err := invokerMSP(ctx)
+	if err != nil {
+		return err
+	}
+	if mspID != transfer.ToMSP {
+		return fmt.Errorf("access denied: only clients of %s may accept the transfer of device %s", transfer.ToMSP, id)
+	}
+
+	asset, err := s.readDevice(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := delTransfer(ctx, id); err != nil {
+		return err
+	}
+	return s.completeTransfer(ctx, asset, transfer.ToMSP)
+}
+
+// CancelTransfer drops the pending transfer of a device. The owning
+// organization may withdraw it and the receiving organization may decline it.
+func (s *SmartContract) CancelTransfer(ctx contractapi.TransactionContextInterface, id string) error {
+	if err := s.authorizeWrite(ctx); err != nil {
+		return err
+	}
+
+	transfer, err := readTransfer(ctx, id)
+	if err != nil {
+		return err
+	}
+	if transfer == nil {
+		return fmt.Errorf("the device %s has no pending transfer", id)
+	}
+	mspID, err := invokerMSP(ctx)
+	if err != nil {
+		return err
+	}
+	if mspID != transfer.ToMSP && mspID != transfer.FromMSP && transfer.FromMSP != "" {
+		return fmt.Errorf("access denied: only clients of %s or %s may cancel the transfer of device %s", transfer.FromMSP, transfer.ToMSP, id)
+	}
+
+	asset, err := s.readDevice(ctx, id)
+	if err != nil {
+		return err
+	}
+	return dropTransfer(ctx, asset, transfer)
+}
+
+// GetPendingTransfer returns the pending transfer of a device
+func (s *SmartContract) GetPendingTransfer(ctx contractapi.TransactionContextInterface, id string) (*DeviceTransfer, error) {
+	if err := s.authorizeRead(ctx); err != nil {
+		return nil, err
+	}
+
+	transfer, err := readTransfer(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if transfer == nil {
+		return nil, fmt.Errorf("the device %s has no pending transfer", id)
+	}
+	return transfer, nil
+}
+
+// completeTransfer records the new owner of the device
+func (s *SmartContract) completeTransfer(ctx contractapi.TransactionContextInterface, asset *Asset, newOwnerMSP string) error {
+	updatedBy, err := invokerID(ctx)
+	if err != nil {
+		return err
+	}
+
+	oldOwnerMSP := asset.OwnerMSP
+	asset.OwnerMSP = newOwnerMSP
+	asset.UpdatedBy = updatedBy
+	if err := s.putDevice(ctx, asset); err != nil {
+		return err
+	}
+	if asset.keyType() == KeyTypeAES {
+		if err := delDeviceKey(ctx, oldOwnerMSP, asset.ID); err != nil {
+			return err
+		}
+	}
+	if err := setDeviceEndorsement(ctx, asset.ID, newOwnerMSP); err != nil {
+		return err
+	}
+
+	return emitEvent(ctx, &DeviceEvent{
+		Event:    EventDeviceTransferred,
+		DeviceID: asset.ID,
+		FromMSP:  oldOwnerMSP,
+		ToMSP:    newOwnerMSP,
+	})
+}
+
+// checkOwner returns an error unless the invoker belongs to the organization
+// owning the device. Devices without a recorded owner pass.
+func checkOwner(ctx contractapi.TransactionContextInterface, asset *Asset) error {
+	if asset.OwnerMSP == "" {
+		return nil
+	}
+	mspID, err := invokerMSP(ctx)
+	if err != nil {
+		return err
+	}
+	if mspID != asset.OwnerMSP {
+		return fmt.Errorf("access denied: the device %s is owned by %s", asset.ID, asset.OwnerMSP)
+	}
+	return nil
+}
+
+// copyDeviceKey copies the key of an AES device to the collection of the
+// organization it is being transferred to
+func copyDeviceKey(ctx contractapi.TransactionContextInterface, asset *Asset, toMSP string) error {
+	if asset.keyType() != KeyTypeAES {
+		return nil
+	}
+	record, err := readDeviceKey(ctx, asset)
+	if err != nil {
+		return err
+	}
+	return putDeviceKey(ctx, toMSP, record)
+}
+
+// dropTransfer removes a pending transfer together with the copy of the
+// device key handed to the receiving organization
+func dropTransfer(ctx contractapi.TransactionContextInterface, asset *Asset, transfer *DeviceTransfer) error {
+	if asset.keyType() == KeyTypeAES {
+		if err := delDeviceKey(ctx, transfer.ToMSP, asset.ID); err != nil {
+			return err
+		}
+	}
+	return delTransfer(ctx, asset.ID)
+}
+
+func readTransfer(ctx contractapi.TransactionContextInterface, id string) (*DeviceTransfer, error) {
+	transferKey, err := ctx.GetStub().CreateCompositeKey(transferIndex, []string{id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transfer key: %v", err)
+	}
+	transferJSON, err := ctx.GetStub().GetState(transferKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transfer: %v", err)
+	}
+	if transferJSON == nil {
+		return nil, nil
+	}
+
+	var transfer DeviceTransfer
+	err = json.Unmarshal(transferJSON, &transfer)
+	if err != nil {
+		return nil, err
+	}
+	return &transfer, nil
+}
+
+func putTransfer(ctx contractapi.TransactionContextInterface, transfer *DeviceTransfer) error {
+	transferKey, err := ctx.GetStub().CreateCompositeKey(transferIndex, []string{transfer.DeviceID})
+	if err != nil {
+		return fmt.Errorf("failed to create transfer key: %v", err)
+	}
+	transferJSON, err := json.Marshal(transfer)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutState(transferKey, transferJSON); err != nil {
+		return fmt.Errorf("failed to put transfer: %v", err)
+	}
+	return nil
+}
+
+func delTransfer(ctx contractapi.TransactionContextInterface, id string) error {
+	transferKey, err := ctx.GetStub().CreateCompositeKey(transferIndex, []string{id})
+	if err != nil {
+		return fmt.Errorf("failed to create transfer key: %v", err)
+	}
+	if err := ctx.GetStub().DelState(transferKey); err != nil {
+		return fmt.Errorf("failed to delete transfer: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func (l *ledger) transfer(id string, newOwnerMSP string) error {
+	return l.submit(func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.TransferDevice(ctx, id, newOwnerMSP)
+	})
+}
+
+func (l *ledger) pendingTransfer(id string) (*chaincode.DeviceTransfer, error) {
+	var transfer *chaincode.DeviceTransfer
+	err := l.evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		transfer, err = l.contract.GetPendingTransfer(ctx, id)
+		return err
+	})
+	return transfer, err
+}
+
+func TestTransferDevice(t *testing.T) {
+	l := newLedger(t)
+	l.register("D1")
+
+	require.NoError(t, l.transfer("D1", "Org2MSP"))
+	require.Equal(t, "Org2MSP", l.asset("D1").OwnerMSP)
+	event := l.lastEvent()
+	require.Equal(t, chaincode.EventDeviceTransferred, event.Event)
+	require.Equal(t, "Org1MSP", event.FromMSP)
+	require.Equal(t, "Org2MSP", event.ToMSP)
+
+	// the key moves to the collection of the new owner
+	require.Nil(t, l.deviceKey("Org1MSP", "D1"))
+	require.Contains(t, string(l.deviceKey("Org2MSP", "D1")), testKey)
+	credential, err := l.authAs(org2Gateway, "D1")
+	require.NoError(t, err)
+	require.Equal(t, testKey, credential.Key)
+	_, err = l.auth("D1")
+	require.EqualError(t, err, "access denied: the device D1 is owned by Org2MSP")
+
+	require.EqualError(t, l.transfer("D1", "Org1MSP"), "access denied: the device D1 is owned by Org2MSP")
+	l.as(org2Admin)
+	require.EqualError(t, l.transfer("D1", "Org2MSP"), "the device D1 is already owned by Org2MSP")
+	require.EqualError(t, l.transfer("D1", "Org3MSP"), "clients of Org3MSP are not allowed to modify devices and cannot own them")
+	require.EqualError(t, l.transfer("D1", ""), "the new owner MSP must not be empty")
+
+	l.update("D1", chaincode.StatusDecommissioned)
+	require.EqualError(t, l.transfer("D1", "Org1MSP"), "the device D1 is decommissioned and cannot be transferred")
+}
+
+func TestTransferAcceptance(t *testing.T) {
+	l := newLedger(t)
+	l.configure(chaincode.Config{RequireTransferAcceptance: true})
+	l.register("D1")
+	l.register("D2")
+
+	require.NoError(t, l.transfer("D1", "Org2MSP"))
+	require.Equal(t, "Org1MSP", l.asset("D1").OwnerMSP)
+	require.Equal(t, chaincode.EventDeviceTransferRequested, l.lastEvent().Event)
+	transfer, err := l.pendingTransfer("D1")
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.DeviceTransfer{
+		DeviceID:    "D1",
+		FromMSP:     "Org1MSP",
+		ToMSP:       "Org2MSP",
+		RequestedBy: "Org1MSP/x509::CN=admin::CN=ca.org1.example.com",
+		RequestedAt: "2024-01-01T00:00:03Z",
+	}, transfer)
+	require.EqualError(t, l.transfer("D1", "Org2MSP"), "the device D1 already has a pending transfer to Org2MSP")
+	// the receiver gets a copy of the key while the owner can still read it
+	require.Contains(t, string(l.deviceKey("Org1MSP", "D1")), testKey)
+	require.Contains(t, string(l.deviceKey("Org2MSP", "D1")), testKey)
+
+	accept := func(id string) error {
+		return l.submit(func(ctx contractapi.TransactionContextInterface) error {
+			return l.contract.AcceptTransfer(ctx, id)
+		})
+	}
+	require.EqualError(t, accept("D1"), "access denied: only clients of Org2MSP may accept the transfer of device D1")
+	require.NoError(t, l.as(org2Admin).submit(func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.AcceptTransfer(ctx, "D1")
+	}))
+	require.Equal(t, "Org2MSP", l.asset("D1").OwnerMSP)
+	require.Nil(t, l.deviceKey("Org1MSP", "D1"))
+	require.NotNil(t, l.deviceKey("Org2MSP", "D1"))
+	_, err = l.pendingTransfer("D1")
+	require.EqualError(t, err, "the device D1 has no pending transfer")
+	require.EqualError(t, accept("D1"), "the device D1 has no pending transfer")
+
+	// either side may cancel a pending transfer
+	cancel := func(id string) error {
+		return l.submit(func(ctx contractapi.TransactionContextInterface) error {
+			return l.contract.CancelTransfer(ctx, id)
+		})
+	}
+	require.NoError(t, l.as(org1Admin).transfer("D2", "Org2MSP"))
+	require.NoError(t, l.as(org2Admin).submit(func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.CancelTransfer(ctx, "D2")
+	}))
+	require.EqualError(t, cancel("D2"), "the device D2 has no pending transfer")
+	require.Equal(t, "Org1MSP", l.asset("D2").OwnerMSP)
+	require.NotNil(t, l.deviceKey("Org1MSP", "D2"))
+	require.Nil(t, l.deviceKey("Org2MSP", "D2"))
+
+	// deleting a device drops its pending transfer
+	require.NoError(t, l.as(org1Admin).transfer("D2", "Org2MSP"))
+	require.NoError(t, l.delete("D2", false))
+	_, err = l.pendingTransfer("D2")
+	require.Error(t, err)
+	require.Nil(t, l.deviceKey("Org1MSP", "D2"))
+	require.Nil(t, l.deviceKey("Org2MSP", "D2"))
+}
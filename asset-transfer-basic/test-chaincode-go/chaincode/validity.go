@@ -0,0 +1,172 @@
+package chaincode
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// maxExpiryWindowDays bounds the window searched by GetExpiringDevices
+const maxExpiryWindowDays = 3650
+
+// DeviceValidity bounds the period in which a device may authenticate. Both
+// ends are optional RFC3339 timestamps; ValidUntil is exclusive.
+type DeviceValidity struct {
+	ValidFrom  string `json:"ValidFrom,omitempty" metadata:",optional"`
+	ValidUntil string `json:"ValidUntil,omitempty" metadata:",optional"`
+}
+
+// SetDeviceValidity replaces the validity period of a device. An empty
+// validFrom or validUntil leaves that end of the period open.
+func (s *SmartContract) SetDeviceValidity(ctx contractapi.TransactionContextInterface, id string, validFrom string, validUntil string) error {
+	if err := s.authorizeWrite(ctx); err != nil {
+		return err
+	}
+
+	validity := DeviceValidity{ValidFrom: validFrom, ValidUntil: validUntil}
+	if err := validity.normalize(); err != nil {
+		return err
+	}
+	asset, err := s.readDevice(ctx, id)
+	if err != nil {
+		return err
+	}
+	updatedBy, err := invokerID(ctx)
+	if err != nil {
+		return err
+	}
+
+	asset.setValidity(validity)
+	asset.UpdatedBy = updatedBy
+	if err := s.putDevice(ctx, asset); err != nil {
+		return err
+	}
+
+	status := storedStatus(asset.Status)
+	return emitDeviceEvent(ctx, EventDeviceUpdated, id, status, status)
+}
+
+// GetExpiringDevices returns the devices whose validity ends within the next
+// days days, soonest first. Devices that have already expired are left out.
+func (s *SmartContract) GetExpiringDevices(ctx contractapi.TransactionContextInterface, days int) ([]*Device_list, error) {
+	if err := s.authorizeRead(ctx); err != nil {
+		return nil, err
+	}
+
+	if days <= 0 || days > maxExpiryWindowDays {
+		return nil, fmt.Errorf("days must be between 1 and %d, got %d", maxExpiryWindowDays, days)
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	horizon := now.AddDate(0, 0, days)
+
+	resultsIterator, err := deviceIterator(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	devices, err := collectDevices(ctx, resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+
+	expiring := []*Device_list{}
+	ends := map[string]time.Time{}
+	for _, device := range devices {
+		if device.ValidUntil == "" {
+			continue
+		}
+		validUntil, err := time.Parse(time.RFC3339, device.ValidUntil)
+		if err != nil {
+			return nil, fmt.Errorf("the device %s has an invalid ValidUntil %q: %v", device.ID, device.ValidUntil, err)
+		}
+		if !validUntil.After(now) || validUntil.After(horizon) {
+			continue
+		}
+		ends[device.ID] = validUntil
+		expiring = append(expiring, device)
+	}
+	sort.SliceStable(expiring, func(i, j int) bool {
+		return ends[expiring[i].ID].Before(ends[expiring[j].ID])
+	})
+
+	return expiring, nil
+}
+
+// normalize validates the validity period in place, rewriting both ends as
+// RFC3339 timestamps in UTC
+func (validity *DeviceValidity) normalize() error {
+	fields := []struct {
+		name  string
+		value *string
+	}{
+		{"ValidFrom", &validity.ValidFrom},
+		{"ValidUntil", &validity.ValidUntil},
+	}
+	for _, field := range fields {
+		*field.value = strings.TrimSpace(*field.value)
+		if *field.value == "" {
+			continue
+		}
+		timestamp, err := time.Parse(time.RFC3339, *field.value)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q, expected an RFC3339 timestamp such as 2025-01-31T00:00:00Z", field.name, *field.value)
+		}
+		*field.value = timestamp.UTC().Format(time.RFC3339)
+	}
+
+	if validity.ValidFrom != "" && validity.ValidUntil != "" && validity.ValidFrom >= validity.ValidUntil {
+		return fmt.Errorf("ValidFrom %s must be before ValidUntil %s", validity.ValidFrom, validity.ValidUntil)
+	}
+	return nil
+}
+
+// check returns an error unless now falls within the validity period
+func (validity DeviceValidity) check(id string, now time.Time) error {
+	if validity.ValidFrom != "" {
+		validFrom, err := time.Parse(time.RFC3339, validity.ValidFrom)
+		if err != nil {
+			return fmt.Errorf("the device %s has an invalid ValidFrom %q: %v", id, validity.ValidFrom, err)
+		}
+		if now.Before(validFrom) {
+			return fmt.Errorf("the device %s is not valid before %s", id, validity.ValidFrom)
+		}
+	}
+	if validity.ValidUntil != "" {
+		validUntil, err := time.Parse(time.RFC3339, validity.ValidUntil)
+		if err != nil {
+			return fmt.Errorf("the device %s has an invalid ValidUntil %q: %v", id, validity.ValidUntil, err)
+		}
+		if !now.Before(validUntil) {
+			return fmt.Errorf("the device %s expired at %s", id, validity.ValidUntil)
+		}
+	}
+	return nil
+}
+
+// expired reports whether the validity period has ended by now. A ValidUntil
+// that cannot be parsed counts as expired, as Auth refuses such devices too.
+func (validity DeviceValidity) expired(now time.Time) bool {
+	if validity.ValidUntil == "" {
+		return false
+	}
+	validUntil, err := time.Parse(time.RFC3339, validity.ValidUntil)
+	return err != nil || !now.Before(validUntil)
+}
+
+// validity returns the validity period of the device
+func (asset *Asset) validity() DeviceValidity {
+	return DeviceValidity{ValidFrom: asset.ValidFrom, ValidUntil: asset.ValidUntil}
+}
+
+// setValidity replaces the validity period of the device
+func (asset *Asset) setValidity(validity DeviceValidity) {
+	asset.ValidFrom = validity.ValidFrom
+	asset.ValidUntil = validity.ValidUntil
+}
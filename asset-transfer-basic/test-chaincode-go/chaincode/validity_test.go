@@ -0,0 +1,105 @@
+package chaincode_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func (l *ledger) setValidity(id string, validFrom string, validUntil string) error {
+	return l.submit(func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.SetDeviceValidity(ctx, id, validFrom, validUntil)
+	})
+}
+
+func (l *ledger) expiring(days int) ([]*chaincode.Device_list, error) {
+	var devices []*chaincode.Device_list
+	err := l.evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		devices, err = l.contract.GetExpiringDevices(ctx, days)
+		return err
+	})
+	return devices, err
+}
+
+func TestDeviceValidity(t *testing.T) {
+	l := newLedger(t)
+	l.stub.Transient = map[string][]byte{"key": []byte(testKey)}
+	require.NoError(t, l.submit(func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.Register(ctx, "D1", chaincode.StatusActive, "", "", "", "2024-01-01T02:00:00+02:00", "2024-01-02T00:00:00Z")
+	}))
+	asset := l.asset("D1")
+	require.Equal(t, "2024-01-01T00:00:00Z", asset.ValidFrom)
+	require.Equal(t, "2024-01-02T00:00:00Z", asset.ValidUntil)
+
+	_, err := l.auth("D1")
+	require.NoError(t, err)
+
+	l.stub.Timestamp = time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	_, err = l.auth("D1")
+	require.EqualError(t, err, "the device D1 expired at 2024-01-02T00:00:00Z")
+
+	require.NoError(t, l.setValidity("D1", "2024-02-01T00:00:00Z", ""))
+	_, err = l.auth("D1")
+	require.EqualError(t, err, "the device D1 is not valid before 2024-02-01T00:00:00Z")
+	require.Equal(t, chaincode.EventDeviceUpdated, l.lastEvent().Event)
+
+	require.NoError(t, l.setValidity("D1", "", ""))
+	_, err = l.auth("D1")
+	require.NoError(t, err)
+	asset = l.asset("D1")
+	require.Empty(t, asset.ValidFrom)
+	require.Empty(t, asset.ValidUntil)
+
+	require.EqualError(t, l.setValidity("D1", "", "tomorrow"), `invalid ValidUntil "tomorrow", expected an RFC3339 timestamp such as 2025-01-31T00:00:00Z`)
+	require.EqualError(t, l.setValidity("D1", "2024-03-01T00:00:00Z", "2024-03-01T00:00:00Z"), "ValidFrom 2024-03-01T00:00:00Z must be before ValidUntil 2024-03-01T00:00:00Z")
+	require.EqualError(t, l.setValidity("D2", "", ""), "the device D2 does not exist")
+}
+
+func TestRegisterBatchValidity(t *testing.T) {
+	l := newLedger(t)
+	l.stub.Transient = map[string][]byte{"keys": []byte(`{"D1": "` + testKey + `", "D2": "` + testKey + `"}`)}
+
+	var issues []*chaincode.BatchIssue
+	require.NoError(t, l.evaluate(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		issues, err = l.contract.CheckBatch(ctx, `[
+			{"ID": "D1", "Status": "active", "ValidUntil": "2024-06-30T00:00:00Z"},
+			{"ID": "D2", "Status": "active", "ValidFrom": "2024-06-30"}
+		]`)
+		return err
+	}))
+	require.Equal(t, []*chaincode.BatchIssue{
+		{Index: 1, ID: "D2", Error: `invalid ValidFrom "2024-06-30", expected an RFC3339 timestamp such as 2025-01-31T00:00:00Z`},
+	}, issues)
+}
+
+func TestGetExpiringDevices(t *testing.T) {
+	l := newLedger(t)
+	for _, id := range []string{"D1", "D2", "D3", "D4", "D5"} {
+		l.register(id)
+	}
+	require.NoError(t, l.setValidity("D1", "", "2024-01-20T00:00:00Z"))
+	require.NoError(t, l.setValidity("D2", "", "2024-01-05T00:00:00Z"))
+	require.NoError(t, l.setValidity("D3", "", "2024-03-01T00:00:00Z"))
+	require.NoError(t, l.setValidity("D4", "", "2024-01-01T00:00:01Z"))
+
+	devices, err := l.expiring(30)
+	require.NoError(t, err)
+	var ids []string
+	for _, device := range devices {
+		ids = append(ids, device.ID)
+	}
+	require.Equal(t, []string{"D2", "D1"}, ids)
+	require.Equal(t, "2024-01-05T00:00:00Z", devices[0].ValidUntil)
+
+	devices, err = l.expiring(1)
+	require.NoError(t, err)
+	require.Empty(t, devices)
+
+	_, err = l.expiring(0)
+	require.EqualError(t, err, "days must be between 1 and 3650, got 0")
+}
@@ -0,0 +1,130 @@
+#!/bin/bash
+
+set -euo pipefail
+
+CHAINCODE_NAME=${CHAINCODE_NAME:-basic}
+CHAINCODE_PATH=${CHAINCODE_PATH:-../asset-transfer-basic/test-chaincode-go}
+APP_URL=${APP_URL:-http://localhost:3001}
+APP_TOKENS=../asset-transfer-basic/app-go/tokens
+DEVICE_ID=device-e2e-$$
+
+function print() {
+	GREEN='\033[0;32m'
+  NC='\033[0m'
+  echo
+	echo -e "${GREEN}${1}${NC}"
+}
+
+function fail() {
+  echo "FAILED: ${1}" >&2
+  exit 1
+}
+
+function createNetwork() {
+  print "Creating network"
+  ./network.sh up createChannel -ca -s couchdb
+  print "Deploying ${CHAINCODE_NAME} chaincode"
+  ./network.sh deployCC -ccn "${CHAINCODE_NAME}" -ccp "${CHAINCODE_PATH}" -ccv 1 -ccs 1 -ccl go
+}
+
+function startApp() {
+  print "Enrolling application identities"
+  pushd ../asset-transfer-basic/app-go
+  ./enrollIdentities.sh
+  # a second admin with a login of their own approves deletions
+  ./enrollIdentities.sh admin appadmin2
+  print "Starting device application"
+  go build -o app-go .
+  CHAINCODE_NAME="${CHAINCODE_NAME}" ./app-go > app.log 2>&1 &
+  APP_PID=$!
+  popd
+
+  for _ in $(seq 1 60); do
+    if curl -s -o /dev/null "${APP_URL}/statuses"; then
+      return
+    fi
+    sleep 1
+  done
+  cat ../asset-transfer-basic/app-go/app.log
+  fail "the application did not start"
+}
+
+function stopNetwork() {
+  print "Stopping network"
+  if [ -n "${APP_PID:-}" ]; then
+    kill "${APP_PID}" || true
+  fi
+  ./network.sh down
+}
+
+# request sends a JSON request to the application logged in as an admin and
+# leaves the response body in BODY and its status code in CODE. An admin
+# without a login token sends a made up one.
+function request() {
+  local method=$1
+  local path=$2
+  local identity=$3
+  local data=${4:-}
+  local token=not-a-login-token
+  local response
+
+  if [ -f "${APP_TOKENS}/${identity}" ]; then
+    token=$(cat "${APP_TOKENS}/${identity}")
+  fi
+  response=$(curl -s -X "${method}" -H "Authorization: Bearer ${token}" -H 'Content-Type: application/json' ${data:+-d "${data}"} -w '\n%{http_code}' "${APP_URL}${path}")
+  BODY=$(echo "${response}" | sed '$d')
+  CODE=$(echo "${response}" | tail -n 1)
+  echo "${method} ${path} as ${identity}: ${CODE} ${BODY}"
+}
+
+# print all executed commands to assist with debug in CI environment
+set -x
+
+createNetwork
+trap stopNetwork EXIT
+startApp
+
+print "Registering device ${DEVICE_ID}"
+request POST /register appadmin1 "{\"esp32id\": \"${DEVICE_ID}\", \"Status\": \"active\", \"key\": \"0123456789abcdef\"}"
+[ "${CODE}" = 200 ] || fail "registering the device returned ${CODE}"
+
+print "Proposing the deletion as appadmin1"
+request POST /delete appadmin1 "{\"esp32id\": \"${DEVICE_ID}\"}"
+[ "${CODE}" = 200 ] || fail "proposing the deletion returned ${CODE}"
+PROPOSAL_ID=$(echo "${BODY}" | jq -r .proposal.id)
+[ "$(echo "${BODY}" | jq -r .proposal.state)" = pending ] || fail "one approval carried out the deletion"
+
+print "Approving again as appadmin1"
+request POST "/proposals/${PROPOSAL_ID}/approve" appadmin1
+[ "${CODE}" = 500 ] || fail "the proposer approved twice"
+echo "${BODY}" | grep -q "has already approved proposal ${PROPOSAL_ID}" || fail "unexpected error for a second approval"
+
+print "Approving as appadmin2"
+request POST "/proposals/${PROPOSAL_ID}/approve" appadmin2
+[ "${CODE}" = 200 ] || fail "approving as appadmin2 returned ${CODE}"
+[ "$(echo "${BODY}" | jq -r .proposal.state)" = executed ] || fail "two approvals did not carry out the deletion"
+[ "$(echo "${BODY}" | jq -r '.proposal.approvals | length')" = 2 ] || fail "the proposal does not list both approvals"
+
+print "Checking that ${DEVICE_ID} is revoked"
+request GET /revocations appadmin1
+[ "${CODE}" = 200 ] || fail "listing revocations returned ${CODE}"
+[ "$(echo "${BODY}" | jq -r --arg id "${DEVICE_ID}" '.devices[] | select(.id == $id) | .reason')" = deleted ] || fail "the device is not listed as deleted"
+
+request GET /proposals appadmin1
+[ "${CODE}" = 200 ] || fail "listing proposals returned ${CODE}"
+[ "$(echo "${BODY}" | jq -r --arg id "${PROPOSAL_ID}" '[.[] | select(.id == $id)] | length')" = 0 ] || fail "the executed proposal is still pending"
+
+print "Anchoring a revocation snapshot"
+request POST /revocations/snapshot appadmin1
+[ "${CODE}" = 200 ] || fail "anchoring the snapshot returned ${CODE}"
+ROOT=$(echo "${BODY}" | jq -r .root)
+request GET "/revocations/snapshot?id=${DEVICE_ID}" appadmin1
+[ "${CODE}" = 200 ] || fail "reading the snapshot returned ${CODE}"
+[ "$(echo "${BODY}" | jq -r .anchor.validationCode)" = VALID ] || fail "the snapshot has no valid anchoring transaction"
+[ "$(echo "${BODY}" | jq -r .anchor.result | jq -r .Root)" = "${ROOT}" ] || fail "the anchoring transaction does not carry the root"
+[ "$(echo "${BODY}" | jq -r '.anchor.endorsements | length')" -gt 0 ] || fail "the anchoring transaction has no endorsements"
+
+request POST /delete unknown "{\"esp32id\": \"${DEVICE_ID}\"}"
+[ "${CODE}" = 401 ] || fail "a request without a valid login was accepted"
+
+{ set +x; } 2>/dev/null
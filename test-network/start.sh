@@ -1,3 +1,5 @@
 ./network.sh up createChannel -ca
 
+(cd ../asset-transfer-basic/app-go && ./enrollIdentities.sh)
+
 ./network.sh deployCC -ccn basic -ccp ../asset-transfer-basic/test-chaincode-go/ -ccl go